@@ -30,6 +30,24 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer stop()
 
+	// url-shortener healthcheck
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		if err := app.RunHealthcheck(ctx, cfg); err != nil {
+			log.Error("server is unhealthy", sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	// url-shortener import [flags] file
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := app.RunImport(ctx, log, cfg, os.Args[2:]); err != nil {
+			log.Error("failed to import links", sl.Err(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := app.RunServer(ctx, log, cfg); err != nil {
 		log.Error("error to start server", sl.Err(err))
 	} else {
@@ -4,33 +4,87 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/neepooha/url_shortener/internal/clicks"
 	ssogrpc "github.com/neepooha/url_shortener/internal/clients/sso/grpc"
 	"github.com/neepooha/url_shortener/internal/config"
+	"github.com/neepooha/url_shortener/internal/expiration"
+	"github.com/neepooha/url_shortener/internal/health"
+	"github.com/neepooha/url_shortener/internal/lib/aliaspolicy"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
 	"github.com/neepooha/url_shortener/internal/lib/migrator"
+	"github.com/neepooha/url_shortener/internal/lib/random"
+	"github.com/neepooha/url_shortener/internal/lib/sequence"
+	"github.com/neepooha/url_shortener/internal/lib/token"
+	"github.com/neepooha/url_shortener/internal/linkio"
+	"github.com/neepooha/url_shortener/internal/metrics"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/cache"
+	"github.com/neepooha/url_shortener/internal/storage/cache/redis"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
 	"github.com/neepooha/url_shortener/internal/storage/postgres"
+	"github.com/neepooha/url_shortener/internal/storage/sqlite"
+	"github.com/neepooha/url_shortener/internal/tracing"
 	admDel "github.com/neepooha/url_shortener/internal/transport/handlers/admins/delete"
 	admSet "github.com/neepooha/url_shortener/internal/transport/handlers/admins/set"
+	healthHandlers "github.com/neepooha/url_shortener/internal/transport/handlers/health"
+	urlBatch "github.com/neepooha/url_shortener/internal/transport/handlers/url/batch"
 	urlDel "github.com/neepooha/url_shortener/internal/transport/handlers/url/delete"
+	urlExport "github.com/neepooha/url_shortener/internal/transport/handlers/url/export"
+	urlHistory "github.com/neepooha/url_shortener/internal/transport/handlers/url/history"
+	urlImport "github.com/neepooha/url_shortener/internal/transport/handlers/url/importer"
+	urlInfo "github.com/neepooha/url_shortener/internal/transport/handlers/url/info"
+	urlList "github.com/neepooha/url_shortener/internal/transport/handlers/url/list"
 	urlRed "github.com/neepooha/url_shortener/internal/transport/handlers/url/redirect"
+	urlRollback "github.com/neepooha/url_shortener/internal/transport/handlers/url/rollback"
 	urlSave "github.com/neepooha/url_shortener/internal/transport/handlers/url/save"
+	urlStats "github.com/neepooha/url_shortener/internal/transport/handlers/url/stats"
+	urlUpdate "github.com/neepooha/url_shortener/internal/transport/handlers/url/update"
 	"github.com/neepooha/url_shortener/internal/transport/middleware/auth"
 	"github.com/neepooha/url_shortener/internal/transport/middleware/isadmin"
 	mwLogger "github.com/neepooha/url_shortener/internal/transport/middleware/logger"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-migrate/migrate/v4"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
 )
 
 func RunServer(ctx context.Context, log *slog.Logger, cfg *config.Config) error {
 	const op = "internal.app.RunServer"
 	log.With(slog.String("op", op))
 
+	// init metrics, they are collected even if not served
+	appMetrics := metrics.New()
+
+	// init tracing
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: cfg.Tracing.ServiceName,
+		Env:         cfg.Env,
+	})
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer func() {
+		// spans of the last requests are flushed after server is shut down
+		flushCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Error("failed to flush spans", sl.Err(err))
+		}
+	}()
+
 	// init ssoServer
 	log.Info("init ssoClinet", slog.String("env", cfg.Env))
 	log.Debug("creddentials sso", slog.String("address", cfg.Clients.SSO.Address))
@@ -39,6 +93,9 @@ func RunServer(ctx context.Context, log *slog.Logger, cfg *config.Config) error
 		log, cfg.Clients.SSO.Address,
 		cfg.Clients.SSO.Timeout,
 		cfg.Clients.SSO.RetriesCount,
+		grpc.WithChainUnaryInterceptor(appMetrics.UnaryClientInterceptor()),
+		// client spans with trace context sent to SSO
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	)
 	if err != nil {
 		log.Error("failed to init ssoClient", sl.Err(err))
@@ -46,51 +103,155 @@ func RunServer(ctx context.Context, log *slog.Logger, cfg *config.Config) error
 	}
 	log.Info("ssoClient was init")
 
-	// init postgresql storage
-	storage, err := postgres.NewStorage(cfg)
+	// init storage
+	log.Info("init storage", slog.String("driver", cfg.Storage.Driver))
+	storage, err := setupStorage(log, cfg)
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	defer storage.CloseStorage()
+	if pgStorage, ok := storage.(*postgres.Storage); ok {
+		appMetrics.RegisterPool(pgStorage.Stat)
+	}
 
-	// start migration
-	err = migrator.Migrate(cfg)
-	if err != nil {
-		if errors.Is(err, migrate.ErrNoChange) {
-			log.Debug("no migrations to apply")
-		} else {
-			panic(err)
+	// init cache of links for redirects, writes through it invalidate cached links
+	db := storage
+	cacheDone := make(chan struct{})
+	if cfg.Cache.Enabled {
+		opts := cache.Options{
+			TTL:         cfg.Cache.TTL,
+			NegativeTTL: cfg.Cache.NegativeTTL,
+			MaxEntries:  cfg.Cache.MaxEntries,
+			MaxBytes:    cfg.Cache.MaxBytes,
 		}
+		if cfg.Cache.Redis.Address != "" {
+			log.Info("init shared cache", slog.String("address", cfg.Cache.Redis.Address))
+			shared, err := redis.New(ctx,
+				cfg.Cache.Redis.Address,
+				cfg.Cache.Redis.Password,
+				cfg.Cache.Redis.DB,
+				cfg.Cache.Redis.Prefix,
+				cfg.Cache.Redis.Channel,
+			)
+			if err != nil {
+				log.Error("failed to init shared cache", sl.Err(err))
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			defer shared.Close()
+			opts.Shared = shared
+		}
+		linkCache := cache.New(log, storage, opts)
+		appMetrics.RegisterCache(
+			func() uint64 { return linkCache.Stats().Hits },
+			func() uint64 { return linkCache.Stats().Misses },
+		)
+		defer func() {
+			stats := linkCache.Stats()
+			log.Info("link cache stats", slog.Uint64("hits", stats.Hits), slog.Uint64("misses", stats.Misses))
+		}()
+		// drop links changed by other instances
+		go func() {
+			defer close(cacheDone)
+			linkCache.Run(ctx)
+		}()
+		storage = linkCache
+	} else {
+		close(cacheDone)
 	}
-	log.Debug("migrations applied successfully")
 
-	// init router
-	router := chi.NewRouter()
-	router.Use(middleware.Logger)
-	router.Use(mwLogger.New(log))
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
+	// init clicks recorder
+	clickRecorder := clicks.New(
+		log, storage,
+		cfg.Clicks.IPSalt,
+		cfg.Clicks.BufferSize,
+		cfg.Clicks.BatchSize,
+		cfg.Clicks.FlushInterval,
+	)
+	appMetrics.RegisterClicks(
+		func() uint64 { return clickRecorder.Stats().Recorded },
+		func() uint64 { return clickRecorder.Stats().Dropped },
+		func() uint64 { return clickRecorder.Stats().Failed },
+	)
 
-	// url router
-	router.Route("/url", func(r chi.Router) {
-		r.Use(auth.New(log, cfg.AppSecret))
-		r.Post("/", urlSave.New(log, storage))
-	})
-	router.Route("/url/{alias}", func(r chi.Router) {
-		r.Use(auth.New(log, cfg.AppSecret))
-		r.Use(isadmin.New(log, ssoClient))
-		r.Delete("/", urlDel.New(log, storage))
+	// start clicks aggregator
+	aggregator := clicks.NewAggregator(log, storage, cfg.Clicks.RollupInterval, cfg.Clicks.RollupBatchSize)
+	aggregatorDone := make(chan struct{})
+	go func() {
+		defer close(aggregatorDone)
+		aggregator.Run(ctx)
+	}()
+
+	// start sweeper of expired links
+	sweeper := expiration.NewSweeper(log, storage,
+		cfg.Expiration.SweepInterval,
+		cfg.Expiration.Grace,
+		cfg.Expiration.Archive,
+	)
+	sweeperDone := make(chan struct{})
+	go func() {
+		defer close(sweeperDone)
+		sweeper.Run(ctx)
+	}()
+
+	// init generator of aliases
+	aliasGenerator, err := setupAliasGenerator(storage, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if g, ok := aliasGenerator.(interface{ Collisions() int64 }); ok {
+		appMetrics.RegisterAliasCollisions(g.Collisions)
+	}
+
+	// init policy of custom aliases
+	aliasPolicy, err := setupAliasPolicy(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// init checks of readiness
+	checker := setupHealthChecker(cfg, db, ssoClient)
+
+	// init verifier of tokens, public keys of sso come along with the secret
+	var keys token.Keys = token.Secret(cfg.AppSecret)
+	if cfg.Auth.JWKS != "" {
+		log.Info("init jwks", slog.String("source", cfg.Auth.JWKS))
+		jwks, err := token.NewJWKS(ctx, log, cfg.Auth.JWKS, cfg.Auth.JWKSRefresh)
+		if err != nil {
+			log.Error("failed to init jwks", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		go jwks.Run(ctx)
+		keys = token.Combined{Secret: token.Secret(cfg.AppSecret), JWKS: jwks}
+	}
+	verifier, err := token.NewVerifier(keys, token.Options{
+		Methods:   cfg.Auth.Algorithms,
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
 	})
-	router.Get("/{alias}", urlRed.New(log, storage))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 
-	// user router
-	router.Route("/user", func(r chi.Router) {
-		r.Post("/", admSet.New(log, ssoClient))
-		r.Delete("/", admDel.New(log, ssoClient))
+	// init router
+	router := newRouter(log, cfg, routerDeps{
+		storage:        storage,
+		db:             db,
+		aliasGenerator: aliasGenerator,
+		aliasPolicy:    aliasPolicy,
+		clickRecorder:  clickRecorder,
+		metrics:        appMetrics,
+		ssoClient:      ssoClient,
+		verifier:       verifier,
+		checker:        checker,
 	})
 
+	// aliases must not shadow routes
+	if err := reserveRoutes(router, aliasPolicy); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
 	// start server
 	srv := &http.Server{
 		Addr:         cfg.Address,
@@ -107,14 +268,234 @@ func RunServer(ctx context.Context, log *slog.Logger, cfg *config.Config) error
 	}()
 	log.Info("url shortener is running", slog.String("addresses", srv.Addr))
 
+	// start metrics server
+	var metricsSrv *http.Server
+	if cfg.Metrics.Enabled {
+		metricsRouter := chi.NewRouter()
+		metricsRouter.Handle("/metrics", appMetrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:        cfg.Metrics.Address,
+			Handler:     metricsRouter,
+			ReadTimeout: cfg.HTTPServer.Timeout,
+			IdleTimeout: cfg.HTTPServer.IdleTimeout,
+		}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("failed to start metrics server", sl.Err(err))
+				os.Exit(1)
+			}
+		}()
+		log.Info("metrics are served", slog.String("address", metricsSrv.Addr))
+	}
+
 	// wait for gracefully shutdown
 	<-ctx.Done()
 	log.Info("shutting down server gracefully")
+	// load balancers see failing readiness and drain traffic before server stops
+	checker.Shutdown()
+	time.Sleep(cfg.HTTPServer.DrainDelay)
 	shutDownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(shutDownCtx); err != nil {
 		return fmt.Errorf("shutdown: %w", err)
 	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutDownCtx); err != nil {
+			return fmt.Errorf("shutdown metrics: %w", err)
+		}
+	}
+	// server doesn't accept redirects anymore, save the rest of clicks
+	if err := clickRecorder.Close(shutDownCtx); err != nil {
+		return fmt.Errorf("flush clicks: %w", err)
+	}
+	<-aggregatorDone
+	<-sweeperDone
+	<-cacheDone
 	<-shutDownCtx.Done()
 	return nil
 }
+
+// routerDeps are services used by handlers of the router
+type routerDeps struct {
+	// storage is wrapped by cache if it's enabled, db isn't
+	storage        storage.URLStorage
+	db             storage.URLStorage
+	aliasGenerator urlSave.AliasGenerator
+	aliasPolicy    *aliaspolicy.Policy
+	clickRecorder  *clicks.Recorder
+	metrics        *metrics.Metrics
+	ssoClient      *ssogrpc.Client
+	verifier       *token.Verifier
+	checker        *health.Checker
+}
+
+// newRouter builds routes of the server. Import without the server builds them
+// only to reserve their segments, so services it doesn't have are nil there.
+func newRouter(log *slog.Logger, cfg *config.Config, d routerDeps) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(middleware.Logger)
+	router.Use(mwLogger.New(log))
+	router.Use(middleware.RequestID)
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.URLFormat)
+	router.Use(d.metrics.Middleware)
+
+	// probes
+	router.Get("/healthz", healthHandlers.NewLive())
+	router.Get("/readyz", healthHandlers.NewReady(log, d.checker))
+
+	// url router
+	router.Route("/url", func(r chi.Router) {
+		r.Use(auth.New(log, d.verifier), auth.RequireAuth(log))
+		r.Post("/", urlSave.New(log, d.storage, d.aliasGenerator, d.aliasPolicy))
+		r.Post("/batch", urlBatch.New(log, d.storage, d.aliasGenerator, d.aliasPolicy, cfg.Batch.MaxItems))
+		// admins may see links of others, SSO is asked only when they are requested
+		requireAdmin := middleware.Maybe(isadmin.RequireAdmin(log, d.ssoClient), requestsOthers)
+		r.With(requireAdmin).Get("/", urlList.New(log, d.storage))
+		r.With(requireAdmin).Get("/export", urlExport.New(log, d.storage, cfg.HTTPServer.Timeout))
+		r.Post("/import", urlImport.New(log, linkio.NewImporter(d.storage, d.aliasPolicy), d.ssoClient, cfg.HTTPServer.Timeout))
+
+		// static routes above win over alias
+		r.Route("/{alias}", func(r chi.Router) {
+			r.Use(isadmin.RequireOwnerOrAdmin(log, d.ssoClient, d.db))
+			// info shows live click counters
+			r.Get("/", urlInfo.New(log, d.db))
+			r.Patch("/", urlUpdate.New(log, d.storage))
+			r.Delete("/", urlDel.New(log, d.storage))
+			r.Get("/history", urlHistory.New(log, d.storage))
+			r.Get("/stats", urlStats.New(log, d.storage))
+			r.Post("/rollback", urlRollback.New(log, d.storage))
+		})
+	})
+	router.Get("/{alias}", urlRed.New(log, d.storage, d.clickRecorder, d.metrics))
+
+	// user router
+	router.Route("/user", func(r chi.Router) {
+		r.Use(auth.New(log, d.verifier), auth.RequireAuth(log))
+		r.Post("/", admSet.New(log, d.ssoClient))
+		r.Delete("/", admDel.New(log, d.ssoClient))
+	})
+	return router
+}
+
+// healthCheckTimeout limits every check of readiness
+const healthCheckTimeout = 2 * time.Second
+
+func setupHealthChecker(cfg *config.Config, db storage.URLStorage, ssoClient *ssogrpc.Client) *health.Checker {
+	checker := health.NewChecker(healthCheckTimeout)
+	if pinger, ok := db.(interface {
+		Ping(ctx context.Context) error
+	}); ok {
+		checker.Add(cfg.Storage.Driver, pinger.Ping)
+	}
+	if cfg.Storage.Driver != storage.DriverMemory {
+		checker.Add("migrations", checkMigrations(cfg))
+	}
+	checker.Add("sso", ssoClient.CheckConnection)
+	return checker
+}
+
+// checkMigrations checks database until all migrations are applied, they can't be reverted while running
+func checkMigrations(cfg *config.Config) health.Check {
+	var applied atomic.Bool
+	return func(context.Context) error {
+		if applied.Load() {
+			return nil
+		}
+		if err := migrator.CheckApplied(cfg); err != nil {
+			return err
+		}
+		applied.Store(true)
+		return nil
+	}
+}
+
+func setupAliasGenerator(ids sequence.IDReserver, cfg *config.Config) (urlSave.AliasGenerator, error) {
+	if cfg.Alias.Strategy == config.AliasStrategySequence {
+		codec := sequence.NewCodec(cfg.Alias.ObfuscationKey)
+		return sequence.NewGenerator(ids, codec, cfg.Alias.Retries), nil
+	}
+	alphabet, err := random.ParseAlphabet(cfg.Alias.Alphabet)
+	if err != nil {
+		return nil, err
+	}
+	return random.NewGenerator(alphabet,
+		cfg.Alias.Length,
+		cfg.Alias.MaxLength,
+		cfg.Alias.Retries,
+		cfg.Alias.GrowAfter,
+	), nil
+}
+
+func setupAliasPolicy(cfg *config.Config) (*aliaspolicy.Policy, error) {
+	policy, err := aliaspolicy.New(
+		cfg.Alias.Policy.Charset,
+		cfg.Alias.Policy.MinLength,
+		cfg.Alias.Policy.MaxLength,
+		cfg.Alias.Policy.Lowercase,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Alias.Policy.ReservedPath != "" {
+		if err := policy.LoadReserved(cfg.Alias.Policy.ReservedPath); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// requestsOthers reports whether list or export asks for links of other users
+func requestsOthers(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Get("owner") != "" || q.Get("all") == "true"
+}
+
+// reserveRoutes reserves static segments of all routes of the router,
+// an alias equal to any of them would be shadowed by GET /{alias} or /url/{alias} routes
+func reserveRoutes(router chi.Routes, policy *aliaspolicy.Policy) error {
+	return chi.Walk(router, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		for _, segment := range strings.Split(route, "/") {
+			if segment != "" && segment != "*" && !strings.HasPrefix(segment, "{") {
+				policy.Reserve(segment)
+			}
+		}
+		return nil
+	})
+}
+
+func setupStorage(log *slog.Logger, cfg *config.Config) (storage.URLStorage, error) {
+	switch cfg.Storage.Driver {
+	case storage.DriverMemory:
+		return memory.NewStorage(), nil
+	case storage.DriverPostgres:
+		pgStorage, err := postgres.NewStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		migrateStorage(log, cfg)
+		return pgStorage, nil
+	case storage.DriverSQLite:
+		sqliteStorage, err := sqlite.NewStorage(cfg)
+		if err != nil {
+			return nil, err
+		}
+		migrateStorage(log, cfg)
+		return sqliteStorage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+func migrateStorage(log *slog.Logger, cfg *config.Config) {
+	err := migrator.Migrate(cfg)
+	if err != nil {
+		if errors.Is(err, migrate.ErrNoChange) {
+			log.Debug("no migrations to apply")
+		} else {
+			panic(err)
+		}
+	}
+	log.Debug("migrations applied successfully")
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/config"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RunHealthcheck asks /healthz of the running server, the image has no curl to do it:
+//
+//	url-shortener healthcheck
+//
+// It checks liveness, not readiness: docker restarts unhealthy containers,
+// and an outage of storage or SSO isn't fixed by a restart.
+func RunHealthcheck(ctx context.Context, cfg *config.Config) error {
+	const op = "internal.app.RunHealthcheck"
+
+	host, port, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(host, port)+"/healthz", nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: server is not alive: %s", op, resp.Status)
+	}
+	return nil
+}
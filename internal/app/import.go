@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/config"
+	"github.com/neepooha/url_shortener/internal/linkio"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RunImport imports links from a file into storage without the server:
+//
+//	url-shortener import [-format csv|ndjson] [-conflict skip|overwrite|fail] [-dry-run] -owner uid [-app-id id] file
+//
+// Records without owner are owned by -owner, which is required, the report is printed to stdout.
+func RunImport(ctx context.Context, log *slog.Logger, cfg *config.Config, args []string) error {
+	const op = "internal.app.RunImport"
+
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "csv or ndjson, by default taken from file extension")
+	conflict := flags.String("conflict", linkio.ConflictSkip, "what to do with taken aliases: skip, overwrite or fail")
+	dryRun := flags.Bool("dry-run", false, "validate and report without saving")
+	owner := flags.Uint64("owner", 0, "uid of owner of records without owner, required")
+	appID := flags.Int("app-id", 0, "app id of imported links")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// uid 0 is nobody, links owned by it couldn't be managed by anyone but admins
+	if *owner == 0 {
+		return fmt.Errorf("%s: -owner is required", op)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%s: expected one file to import", op)
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	f, err := linkio.FormatOf(*format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer file.Close()
+	reader, err := linkio.NewReader(file, f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	storage, err := setupStorage(log, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer storage.CloseStorage()
+	aliasPolicy, err := setupAliasPolicy(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// imported aliases must not shadow routes of the server
+	router := newRouter(log, cfg, routerDeps{storage: storage, db: storage, aliasPolicy: aliasPolicy})
+	if err := reserveRoutes(router, aliasPolicy); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	report, err := linkio.NewImporter(storage, aliasPolicy).Import(ctx, reader, linkio.ImportOptions{
+		DryRun:   *dryRun,
+		Conflict: *conflict,
+		UID:      *owner,
+		AppID:    *appID,
+		AnyOwner: linkio.AllowAnyOwner,
+	})
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(report); encErr != nil {
+		log.Warn("failed to print report")
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if report.Aborted {
+		return fmt.Errorf("%s: import aborted on taken alias", op)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/lib/useragent"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DirectReferrer is the referrer name of clicks without Referer header
+const DirectReferrer = "direct"
+
+type RollupStorage interface {
+	RollupClicks(ctx context.Context, limit int, fold func([]storage.SavedClick) []storage.ClickRollup) (int, error)
+}
+
+// Aggregator periodically folds raw clicks into hourly rollups,
+// so stats are read from a few rows per hour instead of every click.
+type Aggregator struct {
+	log       *slog.Logger
+	storage   RollupStorage
+	interval  time.Duration
+	batchSize int
+}
+
+func NewAggregator(log *slog.Logger, rollupStorage RollupStorage, interval time.Duration, batchSize int) *Aggregator {
+	return &Aggregator{
+		log:       log.With(slog.String("component", "clicks/aggregator")),
+		storage:   rollupStorage,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run aggregates clicks every interval until ctx is done
+func (a *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.log.Info("clicks aggregator stopped")
+			return
+		case <-ticker.C:
+			n, err := a.Aggregate(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				a.log.Error("failed to aggregate clicks", sl.Err(err))
+				continue
+			}
+			if n > 0 {
+				a.log.Debug("clicks aggregated", slog.Int("count", n))
+			}
+		}
+	}
+}
+
+// Aggregate rolls up all clicks which aren't rolled up yet and returns their count
+func (a *Aggregator) Aggregate(ctx context.Context) (int, error) {
+	const op = "clicks.Aggregator.Aggregate"
+
+	total := 0
+	for {
+		// clicks are claimed with their rollups, so a click saved late
+		// with a lower id is counted by the next run
+		n, err := a.storage.RollupClicks(ctx, a.batchSize, Rollup)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", op, err)
+		}
+		total += n
+		if n < a.batchSize {
+			return total, nil
+		}
+	}
+}
+
+// Rollup groups clicks by alias and hour
+func Rollup(clicks []storage.SavedClick) []storage.ClickRollup {
+	type key struct {
+		alias  string
+		bucket time.Time
+	}
+
+	var rollups []storage.ClickRollup
+	index := make(map[key]int)
+	sketches := make(map[key]hll.Sketch)
+	for _, c := range clicks {
+		k := key{alias: c.Alias, bucket: c.ClickedAt.UTC().Truncate(time.Hour)}
+		i, ok := index[k]
+		if !ok {
+			i = len(rollups)
+			index[k] = i
+			sketches[k] = hll.New()
+			rollups = append(rollups, storage.ClickRollup{
+				Alias:      k.alias,
+				Bucket:     k.bucket,
+				Referrers:  make(map[string]int64),
+				UserAgents: make(map[string]int64),
+			})
+		}
+
+		r := &rollups[i]
+		r.Clicks++
+		r.Referrers[referrerName(c.Referrer)]++
+		r.UserAgents[useragent.Family(c.UserAgent)]++
+		if c.IPHash != "" {
+			sketches[k].Add(c.IPHash)
+		}
+	}
+	for k, i := range index {
+		rollups[i].Visitors = sketches[k]
+	}
+	return rollups
+}
+
+func referrerName(referrer string) string {
+	if referrer == "" {
+		return DirectReferrer
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return "other"
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,78 @@
+package clicks
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chromeUA  = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+	firefoxUA = "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0"
+)
+
+func TestAggregateAndBuildStats(t *testing.T) {
+	ctx := context.Background()
+	s := memory.NewStorage()
+	// clicks of missing links aren't saved
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "other", 1, 1, storage.SaveOptions{}))
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var batch []storage.Click
+	for i := 0; i < 30; i++ {
+		batch = append(batch, storage.Click{
+			Alias:     "habr",
+			ClickedAt: day.Add(10*time.Hour + time.Duration(i)*time.Minute),
+			Referrer:  "https://www.t.me/channel",
+			UserAgent: chromeUA,
+			IPHash:    fmt.Sprintf("visitor-%d", i%10),
+		})
+	}
+	for i := 0; i < 5; i++ {
+		batch = append(batch, storage.Click{
+			Alias:     "habr",
+			ClickedAt: day.Add(26 * time.Hour),
+			UserAgent: firefoxUA,
+			IPHash:    "visitor-0",
+		})
+	}
+	batch = append(batch, storage.Click{Alias: "other", ClickedAt: day})
+	require.NoError(t, s.SaveClicks(ctx, batch))
+
+	// small batches make aggregator claim clicks in several runs
+	a := NewAggregator(slogdiscard.NewDiscardLogger(), s, time.Minute, 7)
+	n, err := a.Aggregate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(batch), n)
+
+	n, err = a.Aggregate(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	from, to := day, day.Add(48*time.Hour)
+	rollups, err := s.ListClickRollups(ctx, "habr", from, to)
+	require.NoError(t, err)
+
+	stats := BuildStats(rollups, from, to, IntervalDay, 10)
+	require.Len(t, stats.Buckets, 2)
+	assert.Equal(t, int64(35), stats.TotalClicks)
+	assert.Equal(t, int64(30), stats.Buckets[0].Clicks)
+	assert.Equal(t, uint64(10), stats.Buckets[0].UniqueVisitors)
+	assert.Equal(t, uint64(1), stats.Buckets[1].UniqueVisitors)
+	assert.Equal(t, uint64(10), stats.UniqueVisitors)
+	assert.Equal(t, []Count{{Name: "t.me", Clicks: 30}, {Name: DirectReferrer, Clicks: 5}}, stats.TopReferrers)
+	assert.Equal(t, []Count{{Name: "Chrome", Clicks: 30}, {Name: "Firefox", Clicks: 5}}, stats.TopUserAgents)
+
+	hourly := BuildStats(rollups, from, to, IntervalHour, 1)
+	require.Len(t, hourly.Buckets, 48)
+	assert.Equal(t, int64(30), hourly.Buckets[10].Clicks)
+	assert.Len(t, hourly.TopReferrers, 1)
+}
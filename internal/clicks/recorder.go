@@ -0,0 +1,196 @@
+package clicks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrRecorderClosed = errors.New("recorder closed")
+
+// Event is a redirect reported by the redirect handler
+type Event struct {
+	Alias     string
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+	IP        string
+	RequestID string
+}
+
+type ClickSaver interface {
+	SaveClicks(ctx context.Context, clicks []storage.Click) error
+}
+
+// Stats are counters of the recorder since start
+type Stats struct {
+	Recorded uint64 // saved to storage
+	Dropped  uint64 // buffer was full or recorder closed
+	Failed   uint64 // storage returned error
+}
+
+// Recorder buffers clicks in memory and saves them by batches in background,
+// so redirects never wait for the storage. When the buffer is full new clicks are dropped.
+type Recorder struct {
+	log           *slog.Logger
+	saver         ClickSaver
+	ipSalt        []byte
+	batchSize     int
+	flushInterval time.Duration
+	saveTimeout   time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	events chan storage.Click
+	done   chan struct{}
+
+	recorded atomic.Uint64
+	dropped  atomic.Uint64
+	failed   atomic.Uint64
+}
+
+func New(
+	log *slog.Logger,
+	saver ClickSaver,
+	ipSalt string,
+	bufferSize int,
+	batchSize int,
+	flushInterval time.Duration,
+) *Recorder {
+	r := &Recorder{
+		log:           log.With(slog.String("component", "clicks/recorder")),
+		saver:         saver,
+		ipSalt:        []byte(ipSalt),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		saveTimeout:   5 * time.Second,
+		events:        make(chan storage.Click, bufferSize),
+		done:          make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record puts click into the buffer without blocking
+func (r *Recorder) Record(e Event) {
+	click := storage.Click{
+		Alias:     e.Alias,
+		ClickedAt: e.Time.UTC(),
+		Referrer:  e.Referrer,
+		UserAgent: e.UserAgent,
+		IPHash:    r.hashIP(e.IP),
+		RequestID: e.RequestID,
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		r.dropped.Add(1)
+		return
+	}
+	select {
+	case r.events <- click:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Close stops accepting clicks and saves the buffered ones.
+// It returns ctx error if they were not saved before ctx is done.
+func (r *Recorder) Close(ctx context.Context) error {
+	const op = "clicks.Recorder.Close"
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRecorderClosed
+	}
+	r.closed = true
+	close(r.events)
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		stats := r.Stats()
+		r.log.Info("clicks recorder stopped",
+			slog.Uint64("recorded", stats.Recorded),
+			slog.Uint64("dropped", stats.Dropped),
+			slog.Uint64("failed", stats.Failed),
+		)
+		return nil
+	case <-ctx.Done():
+		r.log.Error("clicks were not flushed", sl.Err(ctx.Err()), slog.String("op", op))
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) Stats() Stats {
+	return Stats{
+		Recorded: r.recorded.Load(),
+		Dropped:  r.dropped.Load(),
+		Failed:   r.failed.Load(),
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]storage.Click, 0, r.batchSize)
+	for {
+		select {
+		case click, ok := <-r.events:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (r *Recorder) flush(batch []storage.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.saveTimeout)
+	defer cancel()
+
+	if err := r.saver.SaveClicks(ctx, batch); err != nil {
+		r.failed.Add(uint64(len(batch)))
+		r.log.Error("failed to save clicks", sl.Err(err), slog.Int("count", len(batch)))
+		return
+	}
+	r.recorded.Add(uint64(len(batch)))
+	r.log.Debug("clicks saved", slog.Int("count", len(batch)))
+}
+
+// hashIP keeps visitors distinguishable without storing their addresses
+func (r *Recorder) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, r.ipSalt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
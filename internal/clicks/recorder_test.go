@@ -0,0 +1,92 @@
+package clicks
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/lib/logger/handlers/slogdiscard"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSaver struct {
+	mu      sync.Mutex
+	batches [][]storage.Click
+	block   chan struct{}
+}
+
+func (f *fakeSaver) SaveClicks(_ context.Context, clicks []storage.Click) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, append([]storage.Click(nil), clicks...))
+	return nil
+}
+
+func (f *fakeSaver) saved() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, b := range f.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestRecorderBatches(t *testing.T) {
+	saver := &fakeSaver{}
+	r := New(slogdiscard.NewDiscardLogger(), saver, "salt", 100, 10, time.Hour)
+
+	for i := 0; i < 25; i++ {
+		r.Record(Event{Alias: "habr", Time: time.Now(), IP: "10.0.0.1"})
+	}
+	// two full batches are saved without waiting for the ticker
+	require.Eventually(t, func() bool { return saver.saved() == 20 }, time.Second, 10*time.Millisecond)
+
+	// the rest is flushed on close
+	require.NoError(t, r.Close(context.Background()))
+	assert.Equal(t, 25, saver.saved())
+	assert.Len(t, saver.batches, 3)
+	assert.Equal(t, Stats{Recorded: 25}, r.Stats())
+
+	click := saver.batches[0][0]
+	assert.Equal(t, "habr", click.Alias)
+	assert.NotEqual(t, "10.0.0.1", click.IPHash)
+	assert.Len(t, click.IPHash, 64)
+
+	// closed recorder drops clicks
+	r.Record(Event{Alias: "habr"})
+	assert.Equal(t, uint64(1), r.Stats().Dropped)
+	assert.ErrorIs(t, r.Close(context.Background()), ErrRecorderClosed)
+}
+
+func TestRecorderDropsWhenFull(t *testing.T) {
+	saver := &fakeSaver{block: make(chan struct{})}
+	r := New(slogdiscard.NewDiscardLogger(), saver, "salt", 5, 1, time.Hour)
+
+	// first click is taken by the blocked saver, five fill the buffer
+	r.Record(Event{Alias: "habr"})
+	require.Eventually(t, func() bool { return len(r.events) == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 10; i++ {
+		r.Record(Event{Alias: "habr"})
+	}
+	assert.Equal(t, uint64(5), r.Stats().Dropped)
+
+	close(saver.block)
+	require.NoError(t, r.Close(context.Background()))
+	assert.Equal(t, uint64(6), r.Stats().Recorded)
+}
+
+func TestRecorderFlushesByInterval(t *testing.T) {
+	saver := &fakeSaver{}
+	r := New(slogdiscard.NewDiscardLogger(), saver, "salt", 100, 100, 10*time.Millisecond)
+	defer r.Close(context.Background())
+
+	r.Record(Event{Alias: "habr"})
+	require.Eventually(t, func() bool { return saver.saved() == 1 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,109 @@
+package clicks
+
+import (
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"sort"
+	"time"
+)
+
+// intervals of stats buckets
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+type Bucket struct {
+	Time           time.Time
+	Clicks         int64
+	UniqueVisitors uint64
+}
+
+type Count struct {
+	Name   string
+	Clicks int64
+}
+
+type LinkStats struct {
+	Buckets        []Bucket
+	TotalClicks    int64
+	UniqueVisitors uint64 // estimate, ~3% error
+	TopReferrers   []Count
+	TopUserAgents  []Count
+}
+
+// TruncateToInterval returns start of the bucket t belongs to
+func TruncateToInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	if interval == IntervalDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+// BuildStats merges hourly rollups into buckets of interval covering [from, to).
+// Buckets without clicks are included with zero counts.
+func BuildStats(rollups []storage.ClickRollup, from time.Time, to time.Time, interval string, top int) LinkStats {
+	step := time.Hour
+	if interval == IntervalDay {
+		step = 24 * time.Hour
+	}
+
+	var (
+		stats      LinkStats
+		index      = make(map[time.Time]int)
+		sketches   []hll.Sketch
+		total      = hll.New()
+		referrers  = make(map[string]int64)
+		userAgents = make(map[string]int64)
+	)
+	for t := TruncateToInterval(from, interval); t.Before(to); t = t.Add(step) {
+		index[t] = len(stats.Buckets)
+		stats.Buckets = append(stats.Buckets, Bucket{Time: t})
+		sketches = append(sketches, hll.New())
+	}
+
+	for _, r := range rollups {
+		i, ok := index[TruncateToInterval(r.Bucket, interval)]
+		if !ok {
+			continue
+		}
+		stats.Buckets[i].Clicks += r.Clicks
+		stats.TotalClicks += r.Clicks
+		if visitors, err := hll.FromBytes(r.Visitors); err == nil {
+			sketches[i].Merge(visitors)
+			total.Merge(visitors)
+		}
+		for name, clicks := range r.Referrers {
+			referrers[name] += clicks
+		}
+		for name, clicks := range r.UserAgents {
+			userAgents[name] += clicks
+		}
+	}
+
+	for i := range stats.Buckets {
+		stats.Buckets[i].UniqueVisitors = sketches[i].Estimate()
+	}
+	stats.UniqueVisitors = total.Estimate()
+	stats.TopReferrers = topCounts(referrers, top)
+	stats.TopUserAgents = topCounts(userAgents, top)
+	return stats
+}
+
+func topCounts(counts map[string]int64, top int) []Count {
+	res := make([]Count, 0, len(counts))
+	for name, clicks := range counts {
+		res = append(res, Count{Name: name, Clicks: clicks})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Clicks != res[j].Clicks {
+			return res[i].Clicks > res[j].Clicks
+		}
+		return res[i].Name < res[j].Name
+	})
+	if len(res) > top {
+		res = res[:top]
+	}
+	return res
+}
@@ -4,23 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	grpclog "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	grpcretry "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/retry"
 	ssov2 "github.com/neepooha/protos/gen/go/sso"
+	"github.com/neepooha/url_shortener/internal/clients/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 type Client struct {
+	cc   *grpc.ClientConn
 	auth ssov2.AuthClient
 	perm ssov2.PermissionsClient
 	log  *slog.Logger
 }
 
-func New(ctx context.Context, log *slog.Logger, addr string, timeout time.Duration, retriesCount int) (*Client, error) {
+// New connects to SSO, opts go before the own ones, so their interceptors see whole calls with retries
+func New(ctx context.Context, log *slog.Logger, addr string, timeout time.Duration, retriesCount int, opts ...grpc.DialOption) (*Client, error) {
 	const op = "grpc.New"
 
 	retryOpts := []grpcretry.CallOption{
@@ -32,26 +38,47 @@ func New(ctx context.Context, log *slog.Logger, addr string, timeout time.Durati
 		grpclog.WithLogOnEvents(grpclog.PayloadSent, grpclog.PayloadReceived),
 	}
 
-	cc, err := grpc.NewClient(
-		addr,
+	opts = append(opts,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithChainUnaryInterceptor(
 			grpclog.UnaryClientInterceptor(InterceptorLogger(log), logOpts...),
 			grpcretry.UnaryClientInterceptor(retryOpts...),
 		),
 	)
+	cc, err := grpc.NewClient(addr, opts...)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return &Client{
+		cc:   cc,
 		auth: ssov2.NewAuthClient(cc),
 		perm: ssov2.NewPermissionsClient(cc),
 		log:  log,
 	}, nil
 }
 
+// CheckConnection waits until connection to SSO is ready, an idle one is connected first
+func (c *Client) CheckConnection(ctx context.Context) error {
+	const op = "grpc.CheckConnection"
+
+	for {
+		state := c.cc.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			c.cc.Connect()
+		case connectivity.Shutdown:
+			return fmt.Errorf("%s: connection is closed", op)
+		}
+		if !c.cc.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("%s: connection is %s: %w", op, strings.ToLower(state.String()), ctx.Err())
+		}
+	}
+}
+
 func (c *Client) IsAdmin(ctx context.Context, userID uint64, appID int) (bool, error) {
 	const op = "grpc.IsAdmin"
 	resp, err := c.perm.IsAdmin(ctx, &ssov2.IsAdminRequest{
@@ -59,7 +86,7 @@ func (c *Client) IsAdmin(ctx context.Context, userID uint64, appID int) (bool, e
 		AppId:  int32(appID),
 	})
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		return false, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 	return resp.GetIsAdmin(), nil
 }
@@ -72,7 +99,7 @@ func (c *Client) SetAdmin(ctx context.Context, email string, appID int) (bool, e
 		AppId: int32(appID),
 	})
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		return false, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 	return resp.GetSetAdmin(), nil
 }
@@ -84,11 +111,39 @@ func (c *Client) DelAdmin(ctx context.Context, email string, appID int) (bool, e
 		AppId: int32(appID),
 	})
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		return false, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 	return resp.GetDelAdmin(), nil
 }
 
+// mapError turns gRPC status of err into sso errors keeping status message
+func mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var domainErr error
+	switch st.Code() {
+	case codes.InvalidArgument:
+		domainErr = sso.ErrInvalidArgument
+	case codes.Unauthenticated:
+		domainErr = sso.ErrUnauthenticated
+	case codes.PermissionDenied:
+		domainErr = sso.ErrPermissionDenied
+	case codes.NotFound:
+		domainErr = sso.ErrNotFound
+	case codes.AlreadyExists:
+		domainErr = sso.ErrAlreadyExists
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		domainErr = sso.ErrUnavailable
+	case codes.Canceled:
+		domainErr = context.Canceled
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %s", domainErr, st.Message())
+}
+
 func InterceptorLogger(log *slog.Logger) grpclog.Logger {
 	return grpclog.LoggerFunc(func(ctx context.Context, level grpclog.Level, msg string, fields ...any) {
 		log.Log(ctx, slog.Level(level), msg, fields...)
@@ -0,0 +1,41 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/neepooha/url_shortener/internal/clients/sso"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "invalid credentials", err: status.Error(codes.InvalidArgument, "invalid credentials"), want: sso.ErrInvalidArgument},
+		{name: "unauthenticated", err: status.Error(codes.Unauthenticated, "token expired"), want: sso.ErrUnauthenticated},
+		{name: "permission denied", err: status.Error(codes.PermissionDenied, "not a creator"), want: sso.ErrPermissionDenied},
+		{name: "not found", err: status.Error(codes.NotFound, "user not found"), want: sso.ErrNotFound},
+		{name: "already exists", err: status.Error(codes.AlreadyExists, "already admin"), want: sso.ErrAlreadyExists},
+		{name: "unavailable", err: status.Error(codes.Unavailable, "connection refused"), want: sso.ErrUnavailable},
+		{name: "deadline", err: status.Error(codes.DeadlineExceeded, "timeout"), want: sso.ErrUnavailable},
+		{name: "canceled", err: status.Error(codes.Canceled, "canceled"), want: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapError(tt.err)
+			assert.ErrorIs(t, err, tt.want)
+			assert.Contains(t, err.Error(), status.Convert(tt.err).Message())
+		})
+	}
+
+	internal := status.Error(codes.Internal, "boom")
+	assert.Equal(t, internal, mapError(internal))
+	plain := errors.New("not a status")
+	assert.Equal(t, plain, mapError(plain))
+}
@@ -0,0 +1,14 @@
+// Package sso holds errors of the SSO service independent of its transport,
+// so handlers can check them with errors.Is.
+package sso
+
+import "errors"
+
+var (
+	ErrInvalidArgument  = errors.New("sso: invalid argument")
+	ErrUnauthenticated  = errors.New("sso: unauthenticated")
+	ErrPermissionDenied = errors.New("sso: permission denied")
+	ErrNotFound         = errors.New("sso: not found")
+	ErrAlreadyExists    = errors.New("sso: already exists")
+	ErrUnavailable      = errors.New("sso: unavailable")
+)
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"github.com/neepooha/url_shortener/internal/lib/random"
+	"github.com/neepooha/url_shortener/internal/storage"
+
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/joho/godotenv"
 )
@@ -15,15 +20,25 @@ type Config struct {
 	HTTPServer `yaml:"http_server"`
 	Clients    ClientConfig `yaml:"clients"`
 	AppSecret  string       `yaml:"app_secret" env-required:"true" env:"APP_SECRET"`
+	Auth       Auth         `yaml:"auth"`
+	Clicks     Clicks       `yaml:"clicks"`
+	Expiration Expiration   `yaml:"expiration"`
+	Alias      Alias        `yaml:"alias"`
+	Batch      Batch        `yaml:"batch"`
+	Cache      Cache        `yaml:"cache"`
+	Metrics    Metrics      `yaml:"metrics"`
+	Tracing    Tracing      `yaml:"tracing"`
 }
 
 type Storage struct {
-	Host            string `yaml:"host" env-required:"true"`
-	Port            string `yaml:"port" env-required:"true"`
-	Dbname          string `yaml:"dbname" env-required:"true" env:"POSTGRES_DB"`
-	User            string `yaml:"user" env-required:"true" env:"POSTGRES_USER"`
-	Password        string `yaml:"password" env-required:"true" env:"POSTGRES_PASSWORD"`
-	Migrations_path string `yaml:"migrations_path" env-required:"true"`
+	Driver          string `yaml:"driver" env-default:"postgres" env:"STORAGE_DRIVER"`
+	Host            string `yaml:"host"`
+	Port            string `yaml:"port"`
+	Dbname          string `yaml:"dbname" env:"POSTGRES_DB"`
+	User            string `yaml:"user" env:"POSTGRES_USER"`
+	Password        string `yaml:"password" env:"POSTGRES_PASSWORD"`
+	Path            string `yaml:"path" env:"SQLITE_PATH"`
+	Migrations_path string `yaml:"migrations_path"`
 }
 
 type HTTPServer struct {
@@ -32,6 +47,106 @@ type HTTPServer struct {
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
 	User        string        `yaml:"user" env-required:"true"`
 	Password    string        `yaml:"password" env-required:"true" env:"HTTP_SERVER_PASSWORD"`
+	// readiness fails for drain_delay before shutdown, so load balancers stop sending requests
+	DrainDelay time.Duration `yaml:"drain_delay" env-default:"5s"`
+}
+
+// Auth is how tokens of SSO are verified
+type Auth struct {
+	// tokens signed with other algorithms are rejected
+	Algorithms []string `yaml:"algorithms" env-default:"HS256"`
+	// iss and aud claims are checked unless empty
+	Issuer    string        `yaml:"issuer" env:"AUTH_ISSUER"`
+	Audience  string        `yaml:"audience" env:"AUTH_AUDIENCE"`
+	ClockSkew time.Duration `yaml:"clock_skew" env-default:"30s"`
+	// public keys of SSO, a file or an URL, for RS256, ES256 and EdDSA tokens
+	JWKS        string        `yaml:"jwks" env:"AUTH_JWKS"`
+	JWKSRefresh time.Duration `yaml:"jwks_refresh" env-default:"5m"`
+}
+
+type Clicks struct {
+	BufferSize    int           `yaml:"buffer_size" env-default:"10000"`
+	BatchSize     int           `yaml:"batch_size" env-default:"500"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"1s"`
+	// key of HMAC of visitor IPs, without it hashes are reversed by brute force
+	IPSalt string `yaml:"ip_salt" env-required:"true" env:"CLICKS_IP_SALT"`
+	// rollups for stats are built in background from saved clicks
+	RollupInterval  time.Duration `yaml:"rollup_interval" env-default:"30s"`
+	RollupBatchSize int           `yaml:"rollup_batch_size" env-default:"5000"`
+}
+
+type Expiration struct {
+	SweepInterval time.Duration `yaml:"sweep_interval" env-default:"1m"`
+	// expired links are kept for grace before sweeping
+	Grace   time.Duration `yaml:"grace" env-default:"0s"`
+	Archive bool          `yaml:"archive" env-default:"false"`
+}
+
+type Alias struct {
+	// random aliases or sequence ones encoded from urls.id
+	Strategy string `yaml:"strategy" env-default:"random"`
+	// sequence codes of consecutive ids don't look consecutive with this key
+	ObfuscationKey string `yaml:"obfuscation_key" env:"ALIAS_OBFUSCATION_KEY"`
+	// base62, unambiguous (base62 without 0/O/o, 1/l/I), base64url or custom characters
+	Alphabet string `yaml:"alphabet" env-default:"base62"`
+	Length   int    `yaml:"length" env-default:"6"`
+	// length grows up to max_length when grow_after collisions happen in a row
+	MaxLength int `yaml:"max_length" env-default:"12"`
+	GrowAfter int `yaml:"grow_after" env-default:"2"`
+	Retries   int `yaml:"retries" env-default:"5"`
+	// aliases chosen by users
+	Policy AliasPolicy `yaml:"policy"`
+}
+
+type AliasPolicy struct {
+	// allowed characters in regexp class syntax
+	Charset   string `yaml:"charset" env-default:"A-Za-z0-9_-"`
+	MinLength int    `yaml:"min_length" env-default:"3"`
+	MaxLength int    `yaml:"max_length" env-default:"64"`
+	Lowercase bool   `yaml:"lowercase" env-default:"false"`
+	// file of reserved words, top-level routes are reserved anyway
+	ReservedPath string `yaml:"reserved_path" env:"ALIAS_RESERVED_PATH"`
+}
+
+type Batch struct {
+	MaxItems int `yaml:"max_items" env-default:"500"`
+}
+
+// Cache of links read by redirects
+type Cache struct {
+	Enabled bool          `yaml:"enabled" env-default:"true"`
+	TTL     time.Duration `yaml:"ttl" env-default:"1m"`
+	// unknown aliases are cached too, so they don't hit storage every time
+	NegativeTTL time.Duration `yaml:"negative_ttl" env-default:"10s"`
+	MaxEntries  int           `yaml:"max_entries" env-default:"100000"`
+	MaxBytes    int64         `yaml:"max_bytes" env-default:"67108864"`
+	// shared cache of all instances, empty address disables it
+	Redis Redis `yaml:"redis"`
+}
+
+type Redis struct {
+	Address  string `yaml:"address" env:"CACHE_REDIS_ADDRESS"`
+	Password string `yaml:"password" env:"CACHE_REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env-default:"0"`
+	Prefix   string `yaml:"prefix" env-default:"url-shortener:link:"`
+	// changed aliases are published to channel, so all instances drop them
+	Channel string `yaml:"channel" env-default:"url-shortener:invalidate"`
+}
+
+// Metrics are served on their own address, so they aren't exposed with the API
+type Metrics struct {
+	Enabled bool   `yaml:"enabled" env-default:"true"`
+	Address string `yaml:"address" env-default:":9090" env:"METRICS_ADDRESS"`
+}
+
+type Tracing struct {
+	// none, stdout (local debugging) or otlp
+	Exporter string `yaml:"exporter" env-default:"none" env:"TRACING_EXPORTER"`
+	// OTLP gRPC collector, empty means OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	Insecure    bool    `yaml:"insecure" env-default:"false"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
+	ServiceName string  `yaml:"service_name" env-default:"url-shortener"`
 }
 
 type Client struct {
@@ -66,6 +181,70 @@ func MustLoad() *Config {
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
 		log.Fatal("can't read config ", err)
 	}
+	if err := cfg.Storage.validate(); err != nil {
+		log.Fatal("invalid storage config: ", err)
+	}
+	if err := cfg.Alias.validate(); err != nil {
+		log.Fatal("invalid alias config: ", err)
+	}
+	if err := cfg.Auth.validate(); err != nil {
+		log.Fatal("invalid auth config: ", err)
+	}
 
 	return &cfg
 }
+
+// validate checks fields which are required only by some storage drivers
+func (s *Storage) validate() error {
+	switch s.Driver {
+	case storage.DriverMemory:
+		return nil
+	case storage.DriverPostgres:
+		if s.Host == "" || s.Port == "" || s.Dbname == "" || s.User == "" || s.Password == "" || s.Migrations_path == "" {
+			return errors.New("host, port, dbname, user, password and migrations_path are required for postgres")
+		}
+		return nil
+	case storage.DriverSQLite:
+		if s.Path == "" || s.Migrations_path == "" {
+			return errors.New("path and migrations_path are required for sqlite")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown driver %q", s.Driver)
+	}
+}
+
+func (a *Auth) validate() error {
+	if a.JWKS != "" && a.JWKSRefresh <= 0 {
+		return errors.New("jwks_refresh must be positive")
+	}
+	return nil
+}
+
+// strategies of alias generation for Alias.Strategy
+const (
+	AliasStrategyRandom   = "random"
+	AliasStrategySequence = "sequence"
+)
+
+func (a *Alias) validate() error {
+	if a.Strategy != AliasStrategyRandom && a.Strategy != AliasStrategySequence {
+		return fmt.Errorf("unknown strategy %q", a.Strategy)
+	}
+	if _, err := random.ParseAlphabet(a.Alphabet); err != nil {
+		return err
+	}
+	if a.Length < 1 {
+		return errors.New("length must be positive")
+	}
+	if a.MaxLength < a.Length {
+		return errors.New("max_length must not be less than length")
+	}
+	if a.Retries < 0 || a.GrowAfter < 0 {
+		return errors.New("retries and grow_after must not be negative")
+	}
+	if a.Policy.MinLength < 1 || a.Policy.MaxLength < a.Policy.MinLength {
+		return errors.New("policy min_length must be positive and not more than max_length")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package expiration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"log/slog"
+	"time"
+)
+
+type ExpiredURLDeleter interface {
+	DeleteExpiredURLs(ctx context.Context, cutoff time.Time, archive bool) (int64, error)
+}
+
+// Sweeper periodically purges links expired by date or by clicks.
+// Links are kept for grace after expiration, redirects answer 410 Gone meanwhile.
+type Sweeper struct {
+	log      *slog.Logger
+	deleter  ExpiredURLDeleter
+	interval time.Duration
+	grace    time.Duration
+	archive  bool
+}
+
+func NewSweeper(log *slog.Logger, deleter ExpiredURLDeleter, interval time.Duration, grace time.Duration, archive bool) *Sweeper {
+	return &Sweeper{
+		log:      log.With(slog.String("component", "expiration/sweeper")),
+		deleter:  deleter,
+		interval: interval,
+		grace:    grace,
+		archive:  archive,
+	}
+}
+
+// Run sweeps expired links every interval until ctx is done
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.log.Info("expiration sweeper stopped")
+			return
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				s.log.Error("failed to sweep expired links", sl.Err(err))
+				continue
+			}
+			if n > 0 {
+				s.log.Info("expired links swept", slog.Int64("count", n), slog.Bool("archived", s.archive))
+			}
+		}
+	}
+}
+
+// Sweep removes links expired before now minus grace and returns their count
+func (s *Sweeper) Sweep(ctx context.Context) (int64, error) {
+	const op = "expiration.Sweeper.Sweep"
+
+	n, err := s.deleter.DeleteExpiredURLs(ctx, time.Now().Add(-s.grace), s.archive)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
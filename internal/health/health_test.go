@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("postgres", func(context.Context) error { return nil })
+
+	report := c.Check(ctx)
+	assert.True(t, report.OK())
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+
+	c.Add("sso", func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.New("connection is connecting")
+	})
+	report = c.Check(ctx)
+	assert.False(t, report.OK(), "hanging check is failed by timeout")
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+	assert.Equal(t, StatusFail, report.Checks["sso"].Status)
+	assert.Equal(t, "connection is connecting", report.Checks["sso"].Error)
+}
+
+func TestShutdown(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("postgres", func(context.Context) error { return nil })
+	c.Shutdown()
+
+	report := c.Check(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, StatusShuttingDown, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["postgres"].Status, "dependencies are still reported")
+}
@@ -0,0 +1,160 @@
+package aliaspolicy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Tag validates custom aliases by the policy, e.g. `validate:"omitempty,alias"`.
+// It is expanded to min, max, alias_charset and alias_reserved,
+// so validator.FieldError.ActualTag tells which of them failed.
+const Tag = "alias"
+
+const (
+	TagCharset  = "alias_charset"
+	TagReserved = "alias_reserved"
+)
+
+// Reason explains why the alias failed tag, ok is false for tags of other validators
+func Reason(tag string) (reason string, ok bool) {
+	switch tag {
+	case TagCharset:
+		return "contains not allowed characters", true
+	case TagReserved:
+		return "is reserved", true
+	}
+	return "", false
+}
+
+// Policy describes which custom aliases users may register
+type Policy struct {
+	charset   *regexp.Regexp
+	lowercase bool
+	validate  *validator.Validate
+
+	mu       sync.RWMutex
+	reserved map[string]bool
+	// words which can't be a part of alias, lines "*word*" in the list
+	forbidden []string
+}
+
+// New returns policy allowing aliases of characters from charset
+// (in regexp class syntax, e.g. "A-Za-z0-9_-") with length in [minLength, maxLength].
+// With lowercase aliases are normalized to lower case.
+func New(charset string, minLength int, maxLength int, lowercase bool) (*Policy, error) {
+	const op = "aliaspolicy.New"
+
+	re, err := regexp.Compile("^[" + charset + "]*$")
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid charset: %w", op, err)
+	}
+	p := &Policy{
+		charset:   re,
+		lowercase: lowercase,
+		validate:  validator.New(),
+		reserved:  make(map[string]bool),
+	}
+	// report fields by their json names
+	p.validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+	if err := p.validate.RegisterValidation(TagCharset, func(fl validator.FieldLevel) bool {
+		return p.charset.MatchString(fl.Field().String())
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := p.validate.RegisterValidation(TagReserved, func(fl validator.FieldLevel) bool {
+		return !p.Reserved(fl.Field().String())
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	p.validate.RegisterAlias(Tag, fmt.Sprintf("min=%d,max=%d,%s,%s", minLength, maxLength, TagCharset, TagReserved))
+	return p, nil
+}
+
+// Reserve forbids words as aliases. Line "*word*" forbids aliases containing word.
+// Words are compared case-insensitively.
+func (p *Policy) Reserve(words ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if len(w) > 2 && strings.HasPrefix(w, "*") && strings.HasSuffix(w, "*") {
+			p.forbidden = append(p.forbidden, strings.Trim(w, "*"))
+			continue
+		}
+		if w != "" {
+			p.reserved[w] = true
+		}
+	}
+}
+
+// LoadReserved reserves words from file, one per line. Empty lines and lines starting with # are skipped.
+func (p *Policy) LoadReserved(path string) error {
+	const op = "aliaspolicy.LoadReserved"
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	p.Reserve(words...)
+	return nil
+}
+
+// Reserved reports whether alias is a reserved word or contains a forbidden one
+func (p *Policy) Reserved(alias string) bool {
+	alias = strings.ToLower(alias)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.reserved[alias] {
+		return true
+	}
+	for _, w := range p.forbidden {
+		if strings.Contains(alias, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns alias in the form it is stored
+func (p *Policy) Normalize(alias string) string {
+	alias = strings.TrimSpace(alias)
+	if p.lowercase {
+		alias = strings.ToLower(alias)
+	}
+	return alias
+}
+
+// Struct validates s with validator knowing the alias tag
+func (p *Policy) Struct(s any) error {
+	return p.validate.Struct(s)
+}
@@ -0,0 +1,66 @@
+package aliaspolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Alias string `validate:"omitempty,alias"`
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := New("A-Za-z0-9_-", 3, 10, true)
+	require.NoError(t, err)
+
+	list := filepath.Join(t.TempDir(), "reserved.txt")
+	require.NoError(t, os.WriteFile(list, []byte("# routes\nURL\n\n*bad*\n"), 0o600))
+	require.NoError(t, p.LoadReserved(list))
+	p.Reserve("user")
+
+	tests := []struct {
+		name  string
+		alias string
+		// failed tag, empty if alias is valid
+		tag string
+	}{
+		{name: "valid", alias: "my-link_1"},
+		{name: "empty means random", alias: ""},
+		{name: "too short", alias: "ab", tag: "min"},
+		{name: "too long", alias: strings.Repeat("a", 11), tag: "max"},
+		{name: "slash", alias: "a/b/c", tag: TagCharset},
+		{name: "not ascii", alias: "ссылка", tag: TagCharset},
+		{name: "reserved from file", alias: "url", tag: TagReserved},
+		{name: "reserved in other case", alias: "User", tag: TagReserved},
+		{name: "forbidden word inside", alias: "so-bad-1", tag: TagReserved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Struct(request{Alias: tt.alias})
+			if tt.tag == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var errs validator.ValidationErrors
+			require.ErrorAs(t, err, &errs)
+			require.Len(t, errs, 1)
+			assert.Equal(t, tt.tag, errs[0].ActualTag())
+			assert.Equal(t, Tag, errs[0].Tag())
+		})
+	}
+
+	assert.Equal(t, "mylink", p.Normalize(" MyLink "))
+}
+
+func TestNewInvalidCharset(t *testing.T) {
+	_, err := New("a-", 1, 2, false)
+	assert.NoError(t, err)
+	_, err = New("z-a", 1, 2, false)
+	assert.Error(t, err)
+}
@@ -1,48 +1,123 @@
 package response
 
 import (
+	"encoding/json"
 	"fmt"
-	"strings"
+	"net/http"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-playground/validator/v10"
 )
 
-// general response that every handlers will use
+// general response that every handlers will use on success
 
 type Response struct {
 	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
 }
 
-const (
-	StatusOK    = "OK"
-	StatusError = "Error"
-)
+const StatusOK = "OK"
 
 func OK() Response {
 	return Response{Status: StatusOK}
 }
 
-func Error(msg string) Response {
-	return Response{Status: StatusError, Error: msg}
+// ContentTypeProblem is content type of error responses, see RFC 7807
+const ContentTypeProblem = "application/problem+json"
+
+// machine-readable codes of errors, clients should check them instead of detail
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeAliasExists      = "alias_exists"
+	CodeLinkExpired      = "link_expired"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+	CodeBatchAborted     = "batch_aborted"
+)
+
+// Problem is an error response in RFC 7807 format with extension members
+// code, request_id and invalid_params
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	RequestID     string         `json:"request_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam tells why a field of the request was rejected
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// NewProblem returns problem of the request with status and code
+func NewProblem(r *http.Request, status int, code string, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// WriteProblem writes p as application/problem+json with its status
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// Error writes problem with status, code and detail
+func Error(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	WriteProblem(w, NewProblem(r, status, code, detail))
 }
 
-func ValidationError(errs validator.ValidationErrors) Response {
-	var errMsgs []string
+// Internal writes 500 problem, the reason should be logged instead of sent to client
+func Internal(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusInternalServerError, CodeInternal, "internal error")
+}
 
+// ValidationError writes 400 problem with a reason for every invalid field
+func ValidationError(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	InvalidRequest(w, r, InvalidParams(errs))
+}
+
+// InvalidRequest writes 400 problem with invalid params
+func InvalidRequest(w http.ResponseWriter, r *http.Request, params []InvalidParam) {
+	p := NewProblem(r, http.StatusBadRequest, CodeValidationFailed, "request has invalid fields")
+	p.InvalidParams = params
+	WriteProblem(w, p)
+}
+
+// InvalidParams explains validation errors
+func InvalidParams(errs validator.ValidationErrors) []InvalidParam {
+	params := make([]InvalidParam, 0, len(errs))
 	for _, err := range errs {
+		var reason string
 		switch err.ActualTag() {
 		case "required":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is a required field", err.Field()))
+			reason = "is a required field"
 		case "url":
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not a valid URL", err.Field()))
+			reason = "is not a valid URL"
+		case "min":
+			reason = fmt.Sprintf("must be at least %s", err.Param())
+		case "max":
+			reason = fmt.Sprintf("must be at most %s", err.Param())
 		default:
-			errMsgs = append(errMsgs, fmt.Sprintf("field %s is not valid", err.Field()))
+			reason = "is not valid"
 		}
+		params = append(params, InvalidParam{Name: err.Field(), Reason: reason})
 	}
-
-	return Response{
-		Status: StatusError,
-		Error:  strings.Join(errMsgs, ", "),
-	}
+	return params
 }
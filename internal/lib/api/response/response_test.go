@@ -0,0 +1,50 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestError(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/url/habr", nil)
+
+	Error(w, r, http.StatusNotFound, CodeNotFound, "url by alias was not found")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentTypeProblem, w.Header().Get("Content-Type"))
+	var p Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, Problem{
+		Type:     "about:blank",
+		Title:    "Not Found",
+		Status:   http.StatusNotFound,
+		Detail:   "url by alias was not found",
+		Instance: "/url/habr",
+		Code:     CodeNotFound,
+	}, p)
+}
+
+func TestValidationError(t *testing.T) {
+	type request struct {
+		URL string `validate:"required,url"`
+	}
+	err := validator.New().Struct(request{URL: "not a url"})
+	var errs validator.ValidationErrors
+	require.ErrorAs(t, err, &errs)
+
+	w := httptest.NewRecorder()
+	ValidationError(w, httptest.NewRequest(http.MethodPost, "/url", nil), errs)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var p Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, CodeValidationFailed, p.Code)
+	assert.Equal(t, []InvalidParam{{Name: "URL", Reason: "is not a valid URL"}}, p.InvalidParams)
+}
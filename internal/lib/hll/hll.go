@@ -0,0 +1,108 @@
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// precision of 10 bits gives 1024 registers and ~3% standard error
+const (
+	precision = 10
+	registers = 1 << precision
+)
+
+var ErrInvalidSketch = errors.New("invalid sketch")
+
+// Sketch is a HyperLogLog estimator of distinct values.
+// It is a plain byte slice so it can be stored as is and merged later.
+type Sketch []byte
+
+func New() Sketch {
+	return make(Sketch, registers)
+}
+
+// FromBytes checks that b is a sketch made by New
+func FromBytes(b []byte) (Sketch, error) {
+	if len(b) != registers {
+		return nil, ErrInvalidSketch
+	}
+	return Sketch(b), nil
+}
+
+func (s Sketch) Add(v string) {
+	h := fnv.New64a()
+	h.Write([]byte(v))
+	x := mix(h.Sum64())
+
+	idx := x >> (64 - precision)
+	rank := uint8(bits.LeadingZeros64(x<<precision|1<<(precision-1)) + 1)
+	if rank > s[idx] {
+		s[idx] = rank
+	}
+}
+
+// Merge makes s estimate the union of s and o
+func (s Sketch) Merge(o Sketch) {
+	for i := range s {
+		if o[i] > s[i] {
+			s[i] = o[i]
+		}
+	}
+}
+
+func (s Sketch) Estimate() uint64 {
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, r := range s {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	m := float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix is the splitmix64 finalizer, fnv alone spreads short strings poorly
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// MergeBytes merges two stored sketches, a nil one is treated as empty
+func MergeBytes(a []byte, b []byte) ([]byte, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+	sa, err := FromBytes(a)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	merged := New()
+	merged.Merge(sa)
+	merged.Merge(sb)
+	return merged, nil
+}
@@ -0,0 +1,50 @@
+package hll
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct int
+	}{
+		{name: "empty", distinct: 0},
+		{name: "distinct = 10", distinct: 10},
+		{name: "distinct = 1000", distinct: 1000},
+		{name: "distinct = 100000", distinct: 100000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New()
+			for i := 0; i < tt.distinct; i++ {
+				// duplicates must not change the estimate
+				s.Add(fmt.Sprintf("visitor-%d", i))
+				s.Add(fmt.Sprintf("visitor-%d", i))
+			}
+			assert.InDelta(t, tt.distinct, s.Estimate(), float64(tt.distinct)*0.1)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 3000; i++ {
+		a.Add(fmt.Sprintf("visitor-%d", i))
+	}
+	for i := 2000; i < 5000; i++ {
+		b.Add(fmt.Sprintf("visitor-%d", i))
+	}
+
+	merged, err := FromBytes(append([]byte(nil), a...))
+	require.NoError(t, err)
+	merged.Merge(b)
+	assert.InDelta(t, 5000, merged.Estimate(), 500)
+
+	_, err = FromBytes([]byte{1, 2, 3})
+	assert.ErrorIs(t, err, ErrInvalidSketch)
+}
@@ -0,0 +1,126 @@
+// Package lru is a least recently used cache with TTL of entries and limits on their number and size.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is safe for concurrent use. The least recently used entries are evicted
+// when there are more than maxEntries of them or they take more than maxBytes.
+type Cache[K comparable, V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	sizeOf     func(K, V) int64
+	ll         *list.List
+	items      map[K]*list.Element
+	bytes      int64
+	now        func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	size      int64
+	expiresAt time.Time
+}
+
+// New returns cache with limits, zero limit means no limit.
+// sizeOf estimates bytes taken by an entry, nil counts every entry as 1 byte.
+func New[K comparable, V any](maxEntries int, maxBytes int64, sizeOf func(K, V) int64) *Cache[K, V] {
+	if sizeOf == nil {
+		sizeOf = func(K, V) int64 { return 1 }
+	}
+	return &Cache[K, V]{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		sizeOf:     sizeOf,
+		ll:         list.New(),
+		items:      make(map[K]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns value of key unless it's missing or expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Add puts value for ttl, the entry bigger than maxBytes isn't cached
+func (c *Cache[K, V]) Add(key K, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	size := c.sizeOf(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	e := &entry[K, V]{key: key, value: value, size: size, expiresAt: c.now().Add(ttl)}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += size
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge removes all entries
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[K]*list.Element)
+	c.bytes = 0
+}
+
+// Len is the number of entries including expired ones which weren't evicted yet
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes is the size of all entries
+func (c *Cache[K, V]) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *Cache[K, V]) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*entry[K, V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
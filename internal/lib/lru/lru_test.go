@@ -0,0 +1,54 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEviction(t *testing.T) {
+	c := New[string, int](2, 0, nil)
+	c.Add("a", 1, time.Minute)
+	c.Add("b", 2, time.Minute)
+	_, _ = c.Get("a")
+	c.Add("c", 3, time.Minute)
+
+	_, ok := c.Get("b")
+	assert.False(t, ok, "least recently used is evicted")
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestMaxBytes(t *testing.T) {
+	c := New[string, string](0, 10, func(k, v string) int64 { return int64(len(k) + len(v)) })
+	c.Add("a", "1234", time.Minute)
+	c.Add("b", "1234", time.Minute)
+	c.Add("c", "1234", time.Minute)
+	assert.Equal(t, 2, c.Len())
+	assert.Equal(t, int64(10), c.Bytes())
+
+	c.Add("big", "123456789", time.Minute)
+	_, ok := c.Get("big")
+	assert.False(t, ok, "entry bigger than the limit isn't cached")
+
+	c.Remove("c")
+	assert.Equal(t, int64(5), c.Bytes())
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	c := New[string, int](0, 0, nil)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1, time.Second)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
@@ -1,18 +1,22 @@
 package migrator
 
 import (
+	"errors"
 	"fmt"
 	"github.com/neepooha/url_shortener/internal/config"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"io/fs"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/jackc/pgx/v5/pgconn"
 )
 
 func Migrate(cfg *config.Config) error {
-	m, err := migrate.New("file://"+cfg.Storage.Migrations_path,
-		fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.Storage.User, cfg.Storage.Password, cfg.Storage.Host, cfg.Storage.Port, cfg.Storage.Dbname))
+	m, err := migrate.New("file://"+cfg.Storage.Migrations_path, databaseURL(cfg))
 	if err != nil {
 		return err
 	}
@@ -21,3 +25,61 @@ func Migrate(cfg *config.Config) error {
 	}
 	return nil
 }
+
+// CheckApplied returns an error unless the last migration of the source is applied
+func CheckApplied(cfg *config.Config) error {
+	latest, err := latestVersion("file://" + cfg.Storage.Migrations_path)
+	if err != nil {
+		return err
+	}
+	m, err := migrate.New("file://"+cfg.Storage.Migrations_path, databaseURL(cfg))
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return fmt.Errorf("no migrations applied, latest is %d", latest)
+		}
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < latest {
+		return fmt.Errorf("migration %d applied, latest is %d", version, latest)
+	}
+	return nil
+}
+
+func latestVersion(sourceURL string) (uint, error) {
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+func databaseURL(cfg *config.Config) string {
+	if cfg.Storage.Driver == storage.DriverSQLite {
+		return "sqlite://" + cfg.Storage.Path
+	}
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.Storage.User, cfg.Storage.Password, cfg.Storage.Host, cfg.Storage.Port, cfg.Storage.Dbname)
+}
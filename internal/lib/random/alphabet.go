@@ -0,0 +1,59 @@
+package random
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// names of predefined alphabets for config.Alias.Alphabet
+const (
+	AlphabetBase62      = "base62"
+	AlphabetBase64URL   = "base64url"
+	AlphabetUnambiguous = "unambiguous"
+)
+
+var alphabets = map[string]string{
+	AlphabetBase62:    "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	AlphabetBase64URL: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_",
+	// base62 without look-alikes 0/O/o, 1/l/I
+	AlphabetUnambiguous: "23456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz",
+}
+
+// ParseAlphabet returns characters of predefined alphabet by name,
+// any other value is used as a custom set of characters
+func ParseAlphabet(nameOrChars string) (string, error) {
+	if chars, ok := alphabets[nameOrChars]; ok {
+		return chars, nil
+	}
+	if len(nameOrChars) < 2 {
+		return "", errors.New("alphabet needs at least 2 characters")
+	}
+	seen := make(map[rune]bool, len(nameOrChars))
+	for _, c := range nameOrChars {
+		if c > 127 {
+			return "", fmt.Errorf("alphabet character %q is not ascii", c)
+		}
+		if seen[c] {
+			return "", fmt.Errorf("alphabet character %q is repeated", c)
+		}
+		seen[c] = true
+	}
+	return nameOrChars, nil
+}
+
+// NewString returns random string of size characters from alphabet.
+// Every character is equally likely.
+func NewString(alphabet string, size int) string {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, size)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(fmt.Sprintf("random: crypto/rand failed: %v", err))
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b)
+}
@@ -0,0 +1,76 @@
+package random
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"sync/atomic"
+)
+
+var ErrAliasesExhausted = errors.New("no free alias found")
+
+// Generator picks random aliases and retries when alias is already taken.
+// When aliases of the current length collide growAfter times in a row
+// the keyspace is considered dense and the length grows up to maxLength
+// for this and all next aliases.
+type Generator struct {
+	alphabet   string
+	length     atomic.Int64
+	maxLength  int
+	retries    int
+	growAfter  int
+	collisions atomic.Int64
+	newString  func(alphabet string, size int) string
+}
+
+func NewGenerator(alphabet string, length int, maxLength int, retries int, growAfter int) *Generator {
+	g := &Generator{
+		alphabet:  alphabet,
+		maxLength: max(maxLength, length),
+		retries:   retries,
+		growAfter: growAfter,
+		newString: NewString,
+	}
+	g.length.Store(int64(length))
+	return g
+}
+
+// Generate calls save with new aliases until it succeeds, id is always 0
+// so storage assigns it. Only storage.ErrURLExists is retried,
+// other errors are returned as is. After retries collisions ErrAliasesExhausted is returned.
+func (g *Generator) Generate(_ context.Context, save func(alias string, id int64) error) (string, error) {
+	const op = "random.Generator.Generate"
+
+	inRow := 0
+	for attempt := 0; attempt <= g.retries; attempt++ {
+		length := int(g.length.Load())
+		alias := g.newString(g.alphabet, length)
+		err := save(alias, 0)
+		if err == nil {
+			return alias, nil
+		}
+		if !errors.Is(err, storage.ErrURLExists) {
+			return "", err
+		}
+
+		g.collisions.Add(1)
+		inRow++
+		if g.growAfter > 0 && inRow >= g.growAfter && length < g.maxLength {
+			// another request may have grown it already
+			g.length.CompareAndSwap(int64(length), int64(length+1))
+			inRow = 0
+		}
+	}
+	return "", fmt.Errorf("%s: %w", op, ErrAliasesExhausted)
+}
+
+// Length is the length of next generated alias
+func (g *Generator) Length() int {
+	return int(g.length.Load())
+}
+
+// Collisions is the number of generated aliases which were already taken
+func (g *Generator) Collisions() int64 {
+	return g.collisions.Load()
+}
@@ -0,0 +1,155 @@
+package random
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// takenSaver saves aliases into a set and reports taken ones as storage.ErrURLExists
+type takenSaver struct {
+	mu    sync.Mutex
+	taken map[string]bool
+	calls int
+}
+
+func (s *takenSaver) save(alias string, _ int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.taken[alias] {
+		return storage.ErrURLExists
+	}
+	s.taken[alias] = true
+	return nil
+}
+
+// sequence returns generated strings one by one instead of random ones
+func sequence(aliases ...string) func(string, int) string {
+	i := 0
+	return func(_ string, size int) string {
+		alias := aliases[i]
+		i++
+		return alias[:size]
+	}
+}
+
+func TestGeneratorRetriesCollision(t *testing.T) {
+	s := &takenSaver{taken: map[string]bool{"aaa": true, "bbb": true}}
+	g := NewGenerator("ab", 3, 3, 5, 0)
+	g.newString = sequence("aaa", "bbb", "aba")
+
+	alias, err := g.Generate(context.Background(), s.save)
+	require.NoError(t, err)
+	assert.Equal(t, "aba", alias)
+	assert.Equal(t, 3, s.calls)
+	assert.Equal(t, int64(2), g.Collisions())
+}
+
+func TestGeneratorExhausted(t *testing.T) {
+	s := &takenSaver{taken: map[string]bool{"aa": true}}
+	g := NewGenerator("a", 2, 2, 3, 1)
+
+	_, err := g.Generate(context.Background(), s.save)
+	assert.ErrorIs(t, err, ErrAliasesExhausted)
+	// first attempt and 3 retries
+	assert.Equal(t, 4, s.calls)
+	assert.Equal(t, 2, g.Length())
+}
+
+func TestGeneratorGrowsLength(t *testing.T) {
+	s := &takenSaver{taken: map[string]bool{"aa": true}}
+	g := NewGenerator("a", 2, 4, 5, 2)
+
+	alias, err := g.Generate(context.Background(), s.save)
+	require.NoError(t, err)
+	assert.Equal(t, "aaa", alias)
+	assert.Equal(t, 3, g.Length())
+
+	// dense keyspace is remembered for the next aliases
+	alias, err = g.Generate(context.Background(), s.save)
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", alias)
+
+	// but never grows over max length
+	_, err = g.Generate(context.Background(), s.save)
+	assert.ErrorIs(t, err, ErrAliasesExhausted)
+	assert.Equal(t, 4, g.Length())
+}
+
+func TestGeneratorOtherError(t *testing.T) {
+	errDB := errors.New("connection refused")
+	calls := 0
+	g := NewGenerator(alphabets[AlphabetBase62], 6, 6, 5, 0)
+
+	_, err := g.Generate(context.Background(), func(string, int64) error {
+		calls++
+		return errDB
+	})
+	assert.ErrorIs(t, err, errDB)
+	assert.Equal(t, 1, calls)
+}
+
+func TestGeneratorConcurrent(t *testing.T) {
+	s := &takenSaver{taken: make(map[string]bool)}
+	// 4 characters of 2 letters give only 16 aliases
+	g := NewGenerator("xy", 4, 8, 50, 3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := g.Generate(context.Background(), s.save)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, s.taken, 100)
+	assert.Greater(t, g.Length(), 4)
+}
+
+func TestNewString(t *testing.T) {
+	for name, alphabet := range alphabets {
+		t.Run(name, func(t *testing.T) {
+			str := NewString(alphabet, 1000)
+			assert.Len(t, str, 1000)
+			for _, c := range str {
+				assert.True(t, strings.ContainsRune(alphabet, c))
+			}
+		})
+	}
+	assert.NotContainsf(t, NewString(alphabets[AlphabetUnambiguous], 1000), "0", "look-alike character")
+}
+
+func TestParseAlphabet(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "predefined", value: AlphabetBase62, want: alphabets[AlphabetBase62]},
+		{name: "custom", value: "abc123", want: "abc123"},
+		{name: "too short", value: "a", wantErr: true},
+		{name: "repeated", value: "abca", wantErr: true},
+		{name: "not ascii", value: "abcя", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAlphabet(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
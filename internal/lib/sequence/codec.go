@@ -0,0 +1,135 @@
+package sequence
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strings"
+)
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxLength of a code, 62^11 doesn't fit in int64
+const maxLength = 10
+
+const feistelRounds = 4
+
+var ErrInvalidCode = errors.New("invalid code")
+
+// Codec turns ids into base62 codes and back.
+// Without a key id 1 is "1", id 62 is "10" and so on.
+// With a key ids of every code length are shuffled by a keyed permutation,
+// so codes of consecutive ids don't look consecutive,
+// but codes are still as short as without a key.
+type Codec struct {
+	key []byte
+}
+
+// NewCodec returns codec, empty key turns obfuscation off
+func NewCodec(key string) *Codec {
+	c := &Codec{}
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		c.key = sum[:]
+	}
+	return c
+}
+
+// Encode returns code of a positive id
+func (c *Codec) Encode(id int64) string {
+	if id <= 0 {
+		panic("sequence: id must be positive")
+	}
+	length := 1
+	for length < maxLength && uint64(id) >= pow62(length) {
+		length++
+	}
+	n := uint64(id)
+	if c.key != nil {
+		n = c.permute(n, pow62(length), false)
+	}
+
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = base62[n%62]
+		n /= 62
+	}
+	return string(b)
+}
+
+// Decode returns id of code made by Encode with the same key
+func (c *Codec) Decode(code string) (int64, error) {
+	if code == "" || len(code) > maxLength {
+		return 0, ErrInvalidCode
+	}
+	var n uint64
+	for i := 0; i < len(code); i++ {
+		d := strings.IndexByte(base62, code[i])
+		if d < 0 {
+			return 0, ErrInvalidCode
+		}
+		n = n*62 + uint64(d)
+	}
+	if c.key != nil {
+		n = c.permute(n, pow62(len(code)), true)
+	}
+	// every id has only one code, the one of its own length
+	if n == 0 || (len(code) > 1 && n < pow62(len(code)-1)) {
+		return 0, ErrInvalidCode
+	}
+	return int64(n), nil
+}
+
+// permute is a keyed bijection of [0, domain).
+// Feistel network works on the smallest even number of bits covering domain,
+// values out of domain are encrypted again until they are back (cycle walking).
+func (c *Codec) permute(n uint64, domain uint64, inverse bool) uint64 {
+	half := (bits.Len64(domain-1) + 1) / 2
+	for {
+		if inverse {
+			n = c.feistelInverse(n, half)
+		} else {
+			n = c.feistel(n, half)
+		}
+		if n < domain {
+			return n
+		}
+	}
+}
+
+func (c *Codec) feistel(n uint64, half int) uint64 {
+	mask := uint64(1)<<half - 1
+	l, r := n>>half, n&mask
+	for i := 0; i < feistelRounds; i++ {
+		l, r = r, l^(c.round(i, r)&mask)
+	}
+	return l<<half | r
+}
+
+func (c *Codec) feistelInverse(n uint64, half int) uint64 {
+	mask := uint64(1)<<half - 1
+	l, r := n>>half, n&mask
+	for i := feistelRounds - 1; i >= 0; i-- {
+		l, r = r^(c.round(i, l)&mask), l
+	}
+	return l<<half | r
+}
+
+func (c *Codec) round(i int, v uint64) uint64 {
+	var b [9]byte
+	b[0] = byte(i)
+	binary.BigEndian.PutUint64(b[1:], v)
+	h := sha256.New()
+	h.Write(c.key)
+	h.Write(b[:])
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+func pow62(n int) uint64 {
+	p := uint64(1)
+	for i := 0; i < n; i++ {
+		p *= 62
+	}
+	return p
+}
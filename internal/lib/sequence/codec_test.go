@@ -0,0 +1,92 @@
+package sequence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecPlain(t *testing.T) {
+	c := NewCodec("")
+	tests := []struct {
+		id   int64
+		code string
+	}{
+		{id: 1, code: "1"},
+		{id: 61, code: "z"},
+		{id: 62, code: "10"},
+		{id: 3843, code: "zz"},
+		{id: 3844, code: "100"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, c.Encode(tt.id))
+		id, err := c.Decode(tt.code)
+		require.NoError(t, err)
+		assert.Equal(t, tt.id, id)
+	}
+}
+
+func TestCodecObfuscated(t *testing.T) {
+	c := NewCodec("secret")
+	plain := NewCodec("")
+
+	seen := make(map[string]bool)
+	for id := int64(1); id <= 20000; id++ {
+		code := c.Encode(id)
+		// obfuscation doesn't make codes longer
+		require.Len(t, code, len(plain.Encode(id)))
+		require.False(t, seen[code], "code %s is issued twice", code)
+		seen[code] = true
+
+		decoded, err := c.Decode(code)
+		require.NoError(t, err)
+		require.Equal(t, id, decoded)
+	}
+	assert.NotEqual(t, plain.Encode(1000), c.Encode(1000))
+	assert.NotEqual(t, c.Encode(1000), NewCodec("other").Encode(1000))
+
+	big := int64(1) << 58
+	decoded, err := c.Decode(c.Encode(big))
+	require.NoError(t, err)
+	assert.Equal(t, big, decoded)
+}
+
+func TestCodecDecodeInvalid(t *testing.T) {
+	c := NewCodec("")
+	for _, code := range []string{"", "0", "01", "a-b", "zzzzzzzzzzz"} {
+		_, err := c.Decode(code)
+		assert.ErrorIs(t, err, ErrInvalidCode, code)
+	}
+}
+
+type fakeIDs struct{ last int64 }
+
+func (f *fakeIDs) NextURLID(context.Context) (int64, error) {
+	f.last++
+	return f.last, nil
+}
+
+func TestGeneratorSkipsCustomAliases(t *testing.T) {
+	taken := map[string]bool{"1": true, "2": true}
+	g := NewGenerator(&fakeIDs{}, NewCodec(""), 5)
+
+	var savedID int64
+	alias, err := g.Generate(context.Background(), func(alias string, id int64) error {
+		if taken[alias] {
+			return storage.ErrURLExists
+		}
+		savedID = id
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "3", alias)
+	assert.Equal(t, int64(3), savedID)
+
+	_, err = NewGenerator(&fakeIDs{}, NewCodec(""), 1).Generate(context.Background(), func(string, int64) error {
+		return storage.ErrURLExists
+	})
+	assert.ErrorIs(t, err, ErrCodesExhausted)
+}
@@ -0,0 +1,61 @@
+package sequence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"sync/atomic"
+)
+
+var ErrCodesExhausted = errors.New("no free code found")
+
+type IDReserver interface {
+	NextURLID(ctx context.Context) (int64, error)
+}
+
+// Generator issues aliases encoded from ids of the urls sequence.
+// Ids are never reused, so an alias collides only with a custom alias
+// chosen by a user, then the next id is taken.
+type Generator struct {
+	ids     IDReserver
+	codec   *Codec
+	retries int
+	// codes taken by custom aliases
+	collisions atomic.Int64
+}
+
+func NewGenerator(ids IDReserver, codec *Codec, retries int) *Generator {
+	return &Generator{
+		ids:     ids,
+		codec:   codec,
+		retries: retries,
+	}
+}
+
+// Generate reserves an id and calls save with its code and the id for the new row
+func (g *Generator) Generate(ctx context.Context, save func(alias string, id int64) error) (string, error) {
+	const op = "sequence.Generator.Generate"
+
+	for attempt := 0; attempt <= g.retries; attempt++ {
+		id, err := g.ids.NextURLID(ctx)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		alias := g.codec.Encode(id)
+		err = save(alias, id)
+		if err == nil {
+			return alias, nil
+		}
+		if !errors.Is(err, storage.ErrURLExists) {
+			return "", err
+		}
+		g.collisions.Add(1)
+	}
+	return "", fmt.Errorf("%s: %w", op, ErrCodesExhausted)
+}
+
+// Collisions is the number of codes which were already taken
+func (g *Generator) Collisions() int64 {
+	return g.collisions.Load()
+}
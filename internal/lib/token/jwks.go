@@ -0,0 +1,319 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown key")
+
+var errUnsupportedKey = errors.New("unsupported key")
+
+// minRefreshInterval limits refreshes caused by tokens with unknown kid
+const minRefreshInterval = 10 * time.Second
+
+// maxJWKSSize limits the size of a key set
+const maxJWKSSize = 1 << 20
+
+// JWKS are public keys of SSO by kid, loaded from a file or URL.
+// Keys are refreshed periodically by Run and when a token has an unknown kid,
+// so SSO can rotate keys without restart of the service.
+type JWKS struct {
+	log       *slog.Logger
+	source    string
+	client    *http.Client
+	refresh   time.Duration
+	mu        sync.RWMutex
+	keys      map[string]any
+	fetchedAt time.Time
+	fetchMu   sync.Mutex
+}
+
+// NewJWKS loads keys from source, a path or http(s) URL
+func NewJWKS(ctx context.Context, log *slog.Logger, source string, refresh time.Duration) (*JWKS, error) {
+	const op = "token.NewJWKS"
+
+	if refresh <= 0 {
+		return nil, fmt.Errorf("%s: refresh interval must be positive", op)
+	}
+	j := &JWKS{
+		log:     log,
+		source:  source,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		refresh: refresh,
+	}
+	if err := j.fetch(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return j, nil
+}
+
+// Run refreshes keys every refresh interval until ctx is done, failures keep the previous keys
+func (j *JWKS) Run(ctx context.Context) {
+	const op = "token.JWKS.Run"
+	log := j.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(j.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.fetch(ctx); err != nil {
+				log.Error("failed to refresh keys", sl.Err(err))
+			}
+		}
+	}
+}
+
+// Key returns the key of kid of the token, its type must match the signing method
+func (j *JWKS) Key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := j.lookup(kid)
+	if !ok {
+		// the key may be just rotated
+		if err := j.refreshStale(kid); err != nil {
+			j.log.Warn("failed to refresh keys", sl.Err(err))
+		}
+		if key, ok = j.lookup(kid); !ok {
+			return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+		}
+	}
+
+	var matches bool
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, matches = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, matches = key.(*ecdsa.PublicKey)
+	case *jwt.SigningMethodEd25519:
+		_, matches = key.(ed25519.PublicKey)
+	}
+	if !matches {
+		return nil, fmt.Errorf("key %q doesn't fit signing method %s", kid, token.Method.Alg())
+	}
+	return key, nil
+}
+
+// lookup finds key by kid, a token without kid can use the only key
+func (j *JWKS) lookup(kid string) (any, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// refreshStale loads keys for unknown kid unless they were loaded recently.
+// Tokens waiting for a load in progress use its keys instead of loading them again.
+func (j *JWKS) refreshStale(kid string) error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+
+	if _, ok := j.lookup(kid); ok {
+		return nil
+	}
+	j.mu.RLock()
+	fresh := time.Since(j.fetchedAt) < minRefreshInterval
+	j.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), j.client.Timeout)
+	defer cancel()
+	return j.load(ctx)
+}
+
+func (j *JWKS) fetch(ctx context.Context) error {
+	j.fetchMu.Lock()
+	defer j.fetchMu.Unlock()
+	return j.load(ctx)
+}
+
+// load replaces keys with the ones read from source, fetchMu must be held
+func (j *JWKS) load(ctx context.Context) error {
+	const op = "token.JWKS.load"
+
+	data, err := j.read(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	keys, err := ParseJWKS(j.log, data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	return nil
+}
+
+func (j *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(j.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// jwk is a public key of RFC 7517, other members are ignored
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS returns signing keys of the set by kid. Keys of unsupported types
+// and broken keys are skipped, so one of them doesn't reject the whole set.
+func ParseJWKS(log *slog.Logger, data []byte) (map[string]any, error) {
+	const op = "token.ParseJWKS"
+	log = log.With(slog.String("op", op))
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			log.Debug("key is skipped", slog.String("kid", k.Kid), sl.Err(err))
+			continue
+		}
+		if err != nil {
+			log.Warn("invalid key is skipped", slog.String("kid", k.Kid), sl.Err(err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %q", errUnsupportedKey, k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %q", errUnsupportedKey, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		// e.g. symmetric keys, they aren't published
+		return nil, fmt.Errorf("%w: kty %q", errUnsupportedKey, k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Combined verifies HMAC tokens with secret and others with jwks,
+// so SSO can move to asymmetric keys while old tokens are still valid
+type Combined struct {
+	Secret Secret
+	JWKS   *JWKS
+}
+
+func (c Combined) Key(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return c.Secret.Key(token)
+	}
+	return c.JWKS.Key(token)
+}
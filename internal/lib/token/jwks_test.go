@@ -0,0 +1,258 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func toJWK(t *testing.T, kid string, key any) map[string]string {
+	t.Helper()
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k)}
+	}
+	t.Fatalf("unsupported key %T", key)
+	return nil
+}
+
+// jwksServer serves keys which can be replaced by a test
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests int
+	// delay holds responses, so concurrent tokens wait for the same load
+	delay time.Duration
+}
+
+func newJWKSServer(t *testing.T) *jwksServer {
+	s := &jwksServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		keys, delay := s.keys, s.delay
+		s.mu.Unlock()
+		time.Sleep(delay)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func signKid(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, validClaims())
+	tok.Header["kid"] = kid
+	s, err := tok.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func newJWKSVerifier(t *testing.T, keys Keys) *Verifier {
+	t.Helper()
+	verifier, err := NewVerifier(keys, Options{Methods: []string{"HS256", "RS256", "ES256", "EdDSA"}})
+	require.NoError(t, err)
+	return verifier
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	srv := newJWKSServer(t)
+	srv.set(
+		toJWK(t, "rsa", &rsaKey.PublicKey),
+		toJWK(t, "ec", &ecKey.PublicKey),
+		toJWK(t, "ed", edPub),
+	)
+	jwks, err := NewJWKS(context.Background(), discard, srv.URL, time.Hour)
+	require.NoError(t, err)
+	verifier := newJWKSVerifier(t, Combined{Secret: Secret(secret), JWKS: jwks})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"rs256", signKid(t, jwt.SigningMethodRS256, "rsa", rsaKey), false},
+		{"es256", signKid(t, jwt.SigningMethodES256, "ec", ecKey), false},
+		{"eddsa", signKid(t, jwt.SigningMethodEdDSA, "ed", edKey), false},
+		{"hs256 with secret", sign(t, jwt.SigningMethodHS256, []byte(secret), validClaims()), false},
+		{"kid of another key", signKid(t, jwt.SigningMethodES256, "rsa", ecKey), true},
+		{"unknown kid", signKid(t, jwt.SigningMethodRS256, "old", rsaKey), true},
+		{"without kid", sign(t, jwt.SigningMethodRS256, rsaKey, validClaims()), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint64(7), claims.UID)
+		})
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	srv := newJWKSServer(t)
+	srv.set(toJWK(t, "old", &oldKey.PublicKey))
+	jwks, err := NewJWKS(context.Background(), discard, srv.URL, time.Hour)
+	require.NoError(t, err)
+	verifier := newJWKSVerifier(t, jwks)
+
+	_, err = verifier.Verify(signKid(t, jwt.SigningMethodRS256, "old", oldKey))
+	require.NoError(t, err)
+
+	// sso publishes the new key, tokens with its kid load keys again
+	srv.set(toJWK(t, "new", &newKey.PublicKey))
+	jwks.fetchedAt = time.Time{}
+	_, err = verifier.Verify(signKid(t, jwt.SigningMethodRS256, "new", newKey))
+	require.NoError(t, err)
+	_, err = verifier.Verify(signKid(t, jwt.SigningMethodRS256, "old", oldKey))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// unknown kids don't hammer sso
+	requests := srv.count()
+	for i := 0; i < 5; i++ {
+		_, err = verifier.Verify(signKid(t, jwt.SigningMethodRS256, "forged", oldKey))
+		require.ErrorIs(t, err, ErrInvalidToken)
+	}
+	assert.Equal(t, requests, srv.count())
+
+	// concurrent tokens with a new kid load keys once
+	srv.set(toJWK(t, "old", &oldKey.PublicKey))
+	srv.mu.Lock()
+	srv.delay = 50 * time.Millisecond
+	srv.mu.Unlock()
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Time{}
+	jwks.mu.Unlock()
+	requests = srv.count()
+	tokenStr := signKid(t, jwt.SigningMethodRS256, "old", oldKey)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := verifier.Verify(tokenStr)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, requests+1, srv.count())
+
+	_, err = NewJWKS(context.Background(), discard, srv.URL, 0)
+	assert.Error(t, err, "refresh interval must be positive")
+}
+
+func TestJWKSFile(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(map[string]any{"keys": []any{
+		toJWK(t, "ed", edPub),
+		map[string]string{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	jwks, err := NewJWKS(context.Background(), discard, path, time.Hour)
+	require.NoError(t, err)
+	_, err = newJWKSVerifier(t, jwks).Verify(signKid(t, jwt.SigningMethodEdDSA, "ed", edKey))
+	require.NoError(t, err)
+
+	_, err = NewJWKS(context.Background(), discard, filepath.Join(t.TempDir(), "missing.json"), time.Hour)
+	require.Error(t, err)
+}
+
+func TestParseJWKS(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ed := toJWK(t, "ed", edPub)
+	secp := map[string]string{"kty": "EC", "kid": "secp", "crv": "secp256k1", "x": "AQ", "y": "AQ"}
+	x25519 := map[string]string{"kty": "OKP", "kid": "x25519", "crv": "X25519", "x": b64(edPub)}
+	broken := map[string]string{"kty": "RSA", "kid": "broken", "n": "!", "e": "AQAB"}
+
+	tests := []struct {
+		name    string
+		keys    []map[string]string
+		kids    []string
+		wantErr bool
+	}{
+		{name: "unsupported keys are skipped", keys: []map[string]string{secp, ed, x25519}, kids: []string{"ed"}},
+		{name: "broken key is skipped", keys: []map[string]string{broken, ed}, kids: []string{"ed"}},
+		{name: "no usable keys", keys: []map[string]string{secp, x25519, broken}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(map[string]any{"keys": tt.keys})
+			require.NoError(t, err)
+
+			keys, err := ParseJWKS(discard, data)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var kids []string
+			for kid := range keys {
+				kids = append(kids, kid)
+			}
+			assert.ElementsMatch(t, tt.kids, kids)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Package token verifies JWT issued by SSO.
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrInvalidClaim = errors.New("invalid claim")
+)
+
+// Claims are claims of SSO tokens
+type Claims struct {
+	UID   uint64 `json:"uid"`
+	AppID int    `json:"app_id"`
+	Email string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Validate is called by parser after registered claims are checked
+func (c *Claims) Validate() error {
+	if c.UID == 0 {
+		return fmt.Errorf("%w: uid is required", ErrInvalidClaim)
+	}
+	if c.AppID <= 0 {
+		return fmt.Errorf("%w: app_id is required", ErrInvalidClaim)
+	}
+	return nil
+}
+
+// Keys returns key verifying token, token.Method is already checked against allowed methods
+type Keys interface {
+	Key(token *jwt.Token) (any, error)
+}
+
+// Secret is HMAC key shared with SSO
+type Secret []byte
+
+func (s Secret) Key(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return []byte(s), nil
+}
+
+type Options struct {
+	// Methods are allowed algorithms, e.g. HS256, a token signed with another one is rejected
+	Methods []string
+	// Issuer and Audience are checked unless empty
+	Issuer   string
+	Audience string
+	// ClockSkew is tolerated in exp, nbf and iat
+	ClockSkew time.Duration
+}
+
+type Verifier struct {
+	keys   Keys
+	parser *jwt.Parser
+}
+
+func NewVerifier(keys Keys, opts Options) (*Verifier, error) {
+	const op = "token.NewVerifier"
+
+	if len(opts.Methods) == 0 {
+		return nil, fmt.Errorf("%s: no signing methods allowed", op)
+	}
+	for _, method := range opts.Methods {
+		if m := jwt.GetSigningMethod(method); m == nil || m == jwt.SigningMethodNone {
+			return nil, fmt.Errorf("%s: unknown signing method %q", op, method)
+		}
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(opts.Methods),
+		jwt.WithLeeway(opts.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	return &Verifier{
+		keys:   keys,
+		parser: jwt.NewParser(parserOpts...),
+	}, nil
+}
+
+// Verify checks signature, registered claims and claims of SSO
+func (v *Verifier) Verify(tokenStr string) (*Claims, error) {
+	const op = "token.Verifier.Verify"
+
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(tokenStr, &claims, v.keys.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", op, ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
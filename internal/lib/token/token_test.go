@@ -0,0 +1,110 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.Claims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"uid":    float64(7),
+		"app_id": float64(1),
+		"email":  "user@example.com",
+		"iss":    "sso",
+		"aud":    "url-shortener",
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+}
+
+func with(key string, value any) jwt.MapClaims {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, key)
+	} else {
+		claims[key] = value
+	}
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	verifier, err := NewVerifier(Secret(secret), Options{
+		Methods:   []string{"HS256"},
+		Issuer:    "sso",
+		Audience:  "url-shortener",
+		ClockSkew: 30 * time.Second,
+	})
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "valid", token: sign(t, jwt.SigningMethodHS256, []byte(secret), validClaims()), ok: true},
+		{name: "expired within skew", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("exp", now.Add(-10*time.Second).Unix())), ok: true},
+		{name: "not before within skew", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("nbf", now.Add(10*time.Second).Unix())), ok: true},
+
+		{name: "malformed", token: "not.a.token"},
+		{name: "wrong secret", token: sign(t, jwt.SigningMethodHS256, []byte("other"), validClaims())},
+		{name: "none algorithm", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims())},
+		{name: "not allowed hmac", token: sign(t, jwt.SigningMethodHS512, []byte(secret), validClaims())},
+		{name: "asymmetric algorithm", token: sign(t, jwt.SigningMethodES256, ecKey, validClaims())},
+		{name: "expired", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("exp", now.Add(-time.Minute).Unix()))},
+		{name: "without exp", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("exp", nil))},
+		{name: "not before", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("nbf", now.Add(time.Minute).Unix()))},
+		{name: "issued in future", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("iat", now.Add(time.Minute).Unix()))},
+		{name: "wrong issuer", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("iss", "evil"))},
+		{name: "without issuer", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("iss", nil))},
+		{name: "wrong audience", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("aud", "other-service"))},
+		{name: "without uid", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("uid", nil))},
+		{name: "uid of wrong type", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("uid", "7"))},
+		{name: "negative uid", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("uid", -7))},
+		{name: "without app_id", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("app_id", nil))},
+		{name: "app_id of wrong type", token: sign(t, jwt.SigningMethodHS256, []byte(secret), with("app_id", true))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token)
+			if !tt.ok {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				assert.Nil(t, claims)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, uint64(7), claims.UID)
+			assert.Equal(t, 1, claims.AppID)
+			assert.Equal(t, "user@example.com", claims.Email)
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, err := NewVerifier(Secret(secret), Options{})
+	assert.Error(t, err, "some method must be allowed")
+	_, err = NewVerifier(Secret(secret), Options{Methods: []string{"none"}})
+	assert.Error(t, err)
+	_, err = NewVerifier(Secret(secret), Options{Methods: []string{"HS1024"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+package useragent
+
+import "strings"
+
+// Family returns browser family of the User-Agent header.
+// Order matters: most browsers mention Safari and Chrome for compatibility.
+func Family(ua string) string {
+	if ua == "" {
+		return "Unknown"
+	}
+	lower := strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(lower, "bot"), strings.Contains(lower, "spider"), strings.Contains(lower, "crawl"):
+		return "Bot"
+	case strings.HasPrefix(lower, "curl/"):
+		return "curl"
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "Edge/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"), strings.Contains(ua, "Opera"):
+		return "Opera"
+	case strings.Contains(ua, "YaBrowser/"):
+		return "Yandex Browser"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	default:
+		return "Other"
+	}
+}
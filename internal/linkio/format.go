@@ -0,0 +1,230 @@
+// Package linkio reads and writes links as CSV or NDJSON for imports, exports and backups.
+package linkio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// supported formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format, use csv or ndjson")
+	ErrInvalidHeader = errors.New("csv header has no url column")
+	// ErrInvalidRecord is returned for a broken record, reading can go on after it
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// csvHeader are columns of CSV, NDJSON objects have the same keys
+var csvHeader = []string{"alias", "url", "created_at", "owner"}
+
+// Record is one link of import or export
+type Record struct {
+	Alias     string     `json:"alias"`
+	URL       string     `json:"url"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Owner     uint64     `json:"owner,omitempty"`
+}
+
+// ContentType returns MIME type of format
+func ContentType(format string) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// FormatOf returns format by its name or by MIME type
+func FormatOf(nameOrContentType string) (string, error) {
+	mediaType, _, _ := strings.Cut(strings.ToLower(nameOrContentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case FormatCSV, "text/csv":
+		return FormatCSV, nil
+	case FormatNDJSON, "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return FormatNDJSON, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Reader reads records one by one without loading the whole input
+type Reader struct {
+	format string
+	csv    *csv.Reader
+	lines  *bufio.Scanner
+	// columns maps CSV header names to their positions
+	columns map[string]int
+	line    int
+}
+
+func NewReader(r io.Reader, format string) (*Reader, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		return &Reader{format: format, csv: cr}, nil
+	case FormatNDJSON:
+		lines := bufio.NewScanner(r)
+		lines.Buffer(make([]byte, 64*1024), 1024*1024)
+		return &Reader{format: format, lines: lines}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Line is the line of the last record
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Next returns the next record or io.EOF.
+// Broken record returns ErrInvalidRecord, but reading can go on.
+func (r *Reader) Next() (Record, error) {
+	if r.format == FormatCSV {
+		return r.nextCSV()
+	}
+	return r.nextNDJSON()
+}
+
+func (r *Reader) nextCSV() (Record, error) {
+	if r.columns == nil {
+		header, err := r.csv.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return Record{}, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+			}
+			return Record{}, err
+		}
+		r.columns = make(map[string]int, len(header))
+		for i, name := range header {
+			r.columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+		}
+		if _, ok := r.columns["url"]; !ok {
+			return Record{}, ErrInvalidHeader
+		}
+	}
+
+	row, err := r.csv.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.line = parseErr.Line
+			return Record{}, fmt.Errorf("%w: %v", ErrInvalidRecord, parseErr.Err)
+		}
+		return Record{}, err
+	}
+	r.line, _ = r.csv.FieldPos(0)
+
+	field := func(name string) string {
+		i, ok := r.columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+	rec := Record{Alias: field("alias"), URL: field("url")}
+	if v := field("created_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: created_at must be RFC 3339 time", ErrInvalidRecord)
+		}
+		rec.CreatedAt = &t
+	}
+	if v := field("owner"); v != "" {
+		owner, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: owner must be uid", ErrInvalidRecord)
+		}
+		rec.Owner = owner
+	}
+	return rec, nil
+}
+
+func (r *Reader) nextNDJSON() (Record, error) {
+	for r.lines.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.lines.Text())
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return Record{}, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		return rec, nil
+	}
+	if err := r.lines.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// Writer writes records in format, call Flush after the last one
+type Writer struct {
+	format      string
+	csv         *csv.Writer
+	json        *json.Encoder
+	buf         *bufio.Writer
+	wroteHeader bool
+}
+
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &Writer{format: format, csv: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &Writer{format: format, json: json.NewEncoder(buf), buf: buf}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func (w *Writer) Write(rec Record) error {
+	if w.format == FormatNDJSON {
+		return w.json.Encode(rec)
+	}
+
+	if !w.wroteHeader {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+	var createdAt, owner string
+	if rec.CreatedAt != nil {
+		createdAt = rec.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	if rec.Owner != 0 {
+		owner = strconv.FormatUint(rec.Owner, 10)
+	}
+	return w.csv.Write([]string{rec.Alias, rec.URL, createdAt, owner})
+}
+
+// Flush writes buffered records, the CSV header is written even without records
+func (w *Writer) Flush() error {
+	if w.format == FormatNDJSON {
+		return w.buf.Flush()
+	}
+	if !w.wroteHeader {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
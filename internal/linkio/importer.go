@@ -0,0 +1,291 @@
+package linkio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"io"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// conflict policies for links with an alias which is already taken
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// maxReportErrors limits errors kept in report, the rest are only counted
+const maxReportErrors = 100
+
+var (
+	ErrUnknownConflict = errors.New("unknown conflict policy, use skip, overwrite or fail")
+	errForeignOwner    = errors.New("only admins can import links of other users")
+	errForeignLink     = errors.New("alias is taken by a link of another user")
+)
+
+type ImportStorage interface {
+	SaveURL(ctx context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts storage.SaveOptions) error
+	GetURLOwner(ctx context.Context, alias string) (uint64, error)
+	UpdateURL(ctx context.Context, alias string, newURL string, changedBy uint64) error
+}
+
+type AliasPolicy interface {
+	Normalize(alias string) string
+	Struct(s any) error
+}
+
+type ImportOptions struct {
+	DryRun   bool
+	Conflict string
+	// UID imports links, it owns links without owner and is recorded in history of overwritten ones
+	UID   uint64
+	AppID int
+	// AnyOwner tells if UID may set owner of records and overwrite links of other users.
+	// It's asked once and only if a record needs it, nil means UID may not.
+	AnyOwner func(ctx context.Context) (bool, error)
+}
+
+// AllowAnyOwner lets UID import links of any owner, e.g. on restore of a backup
+func AllowAnyOwner(context.Context) (bool, error) {
+	return true, nil
+}
+
+// ownerCheck asks ImportOptions.AnyOwner once, most imports have only own links
+type ownerCheck struct {
+	ask   func(ctx context.Context) (bool, error)
+	asked bool
+	ok    bool
+}
+
+func (c *ownerCheck) anyOwner(ctx context.Context) (bool, error) {
+	if c.asked || c.ask == nil {
+		return c.ok, nil
+	}
+	ok, err := c.ask(ctx)
+	if err != nil {
+		return false, err
+	}
+	c.asked, c.ok = true, ok
+	return ok, nil
+}
+
+// Report tells what import did or, with dry run, would do
+type Report struct {
+	DryRun      bool        `json:"dry_run"`
+	Total       int         `json:"total"`
+	Created     int         `json:"created"`
+	Overwritten int         `json:"overwritten"`
+	Skipped     int         `json:"skipped"`
+	Failed      int         `json:"failed"`
+	Aborted     bool        `json:"aborted"` // conflict stopped import with fail policy
+	Errors      []LineError `json:"errors,omitempty"`
+}
+
+type LineError struct {
+	Line  int    `json:"line"`
+	Alias string `json:"alias,omitempty"`
+	Error string `json:"error"`
+}
+
+func (r *Report) fail(line int, alias string, err error) {
+	r.Failed++
+	if len(r.Errors) < maxReportErrors {
+		r.Errors = append(r.Errors, LineError{Line: line, Alias: alias, Error: err.Error()})
+	}
+}
+
+// importRecord is a record validated like links created by POST /url
+type importRecord struct {
+	URL   string `json:"url" validate:"required,url"`
+	Alias string `json:"alias" validate:"required,alias"`
+}
+
+// Importer saves records one by one, so input of any size is imported in constant memory
+type Importer struct {
+	storage ImportStorage
+	policy  AliasPolicy
+}
+
+func NewImporter(importStorage ImportStorage, aliasPolicy AliasPolicy) *Importer {
+	return &Importer{
+		storage: importStorage,
+		policy:  aliasPolicy,
+	}
+}
+
+// Import reads all records of r. Broken records are reported and skipped,
+// an error is returned only if import can't go on.
+func (im *Importer) Import(ctx context.Context, r *Reader, opts ImportOptions) (Report, error) {
+	const op = "linkio.Importer.Import"
+
+	report := Report{DryRun: opts.DryRun}
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	if opts.Conflict != ConflictSkip && opts.Conflict != ConflictOverwrite && opts.Conflict != ConflictFail {
+		return report, fmt.Errorf("%s: %w", op, ErrUnknownConflict)
+	}
+
+	// aliases seen in input, dry run doesn't save them but must see repeats
+	seen := make(map[string]bool)
+	check := &ownerCheck{ask: opts.AnyOwner}
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if errors.Is(err, ErrInvalidRecord) {
+			report.Total++
+			report.fail(r.Line(), "", err)
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", op, err)
+		}
+		report.Total++
+		line := r.Line()
+
+		rec.Alias = im.policy.Normalize(rec.Alias)
+		if err := im.policy.Struct(importRecord{URL: rec.URL, Alias: rec.Alias}); err != nil {
+			report.fail(line, rec.Alias, validationError(err))
+			continue
+		}
+		owner := rec.Owner
+		if owner == 0 {
+			owner = opts.UID
+		}
+		if owner != opts.UID {
+			anyOwner, err := check.anyOwner(ctx)
+			if err != nil {
+				return report, fmt.Errorf("%s: %w", op, err)
+			}
+			if !anyOwner {
+				report.fail(line, rec.Alias, errForeignOwner)
+				continue
+			}
+		}
+
+		exists := seen[rec.Alias]
+		var existingOwner uint64
+		if !exists {
+			existingOwner, err = im.storage.GetURLOwner(ctx, rec.Alias)
+			switch {
+			case err == nil:
+				exists = true
+			case errors.Is(err, storage.ErrURLNotFound):
+			default:
+				return report, fmt.Errorf("%s: %w", op, err)
+			}
+		} else {
+			// repeated alias of this input belongs to the importer
+			existingOwner = owner
+		}
+		seen[rec.Alias] = true
+
+		if !exists {
+			if !opts.DryRun {
+				err := im.save(ctx, rec, owner, opts.AppID)
+				if errors.Is(err, storage.ErrURLExists) {
+					// saved by somebody else meanwhile
+					report.fail(line, rec.Alias, err)
+					continue
+				}
+				if err != nil {
+					return report, fmt.Errorf("%s: %w", op, err)
+				}
+			}
+			report.Created++
+			continue
+		}
+
+		switch opts.Conflict {
+		case ConflictSkip:
+			report.Skipped++
+		case ConflictFail:
+			report.fail(line, rec.Alias, storage.ErrURLExists)
+			report.Aborted = true
+			return report, nil
+		case ConflictOverwrite:
+			if existingOwner != opts.UID {
+				anyOwner, err := check.anyOwner(ctx)
+				if err != nil {
+					return report, fmt.Errorf("%s: %w", op, err)
+				}
+				if !anyOwner {
+					report.fail(line, rec.Alias, errForeignLink)
+					continue
+				}
+			}
+			if !opts.DryRun {
+				if err := im.storage.UpdateURL(ctx, rec.Alias, rec.URL, opts.UID); err != nil {
+					return report, fmt.Errorf("%s: %w", op, err)
+				}
+			}
+			report.Overwritten++
+		}
+	}
+}
+
+func (im *Importer) save(ctx context.Context, rec Record, owner uint64, appID int) error {
+	var opts storage.SaveOptions
+	if rec.CreatedAt != nil {
+		opts.CreatedAt = *rec.CreatedAt
+	}
+	return im.storage.SaveURL(ctx, rec.URL, rec.Alias, owner, appID, opts)
+}
+
+func validationError(err error) error {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		return err
+	}
+	return fmt.Errorf("field %s is not valid (%s)", errs[0].Field(), errs[0].ActualTag())
+}
+
+// ExportStorage lists links page by page
+type ExportStorage interface {
+	ListURLs(ctx context.Context, filter storage.ListFilter) ([]storage.URL, error)
+}
+
+// exportPageSize is how many links are read from storage at once
+const exportPageSize = 1000
+
+// Export writes links matching filter oldest first, reading them page by page.
+// afterPage is called after every page, e.g. to flush the response.
+func Export(ctx context.Context, exportStorage ExportStorage, w *Writer, filter storage.ListFilter, afterPage func() error) (int, error) {
+	const op = "linkio.Export"
+
+	filter.Asc = true
+	filter.Limit = exportPageSize
+	total := 0
+	for {
+		links, err := exportStorage.ListURLs(ctx, filter)
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", op, err)
+		}
+		for _, l := range links {
+			createdAt := l.CreatedAt
+			err := w.Write(Record{Alias: l.Alias, URL: l.URL, CreatedAt: &createdAt, Owner: l.OwnerUID})
+			if err != nil {
+				return total, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		total += len(links)
+		if err := w.Flush(); err != nil {
+			return total, fmt.Errorf("%s: %w", op, err)
+		}
+		if afterPage != nil {
+			if err := afterPage(); err != nil {
+				return total, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		if len(links) < filter.Limit {
+			return total, nil
+		}
+		last := links[len(links)-1]
+		filter.After = &storage.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+}
@@ -0,0 +1,163 @@
+package linkio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/neepooha/url_shortener/internal/lib/aliaspolicy"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Alias: "first", URL: "https://example.com/a,b", CreatedAt: &createdAt, Owner: 7},
+		{Alias: "second", URL: "https://example.com/\"q\""},
+	}
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, format)
+			require.NoError(t, err)
+			for _, rec := range records {
+				require.NoError(t, w.Write(rec))
+			}
+			require.NoError(t, w.Flush())
+
+			r, err := NewReader(&buf, format)
+			require.NoError(t, err)
+			var got []Record
+			for {
+				rec, err := r.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, rec)
+			}
+			assert.Equal(t, records, got)
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	policy, err := aliaspolicy.New("A-Za-z0-9_-", 3, 16, false)
+	require.NoError(t, err)
+
+	const input = "alias,url,owner\n" +
+		"taken,https://example.com/new,\n" +
+		"fresh,https://example.com/fresh,\n" +
+		"fresh,https://example.com/again,\n" +
+		"bad alias,https://example.com,\n" +
+		"other,https://example.com/other,2\n" +
+		"\"broken,quote\n"
+
+	tests := []struct {
+		name       string
+		opts       ImportOptions
+		want       Report
+		takenURL   string
+		freshSaved bool
+	}{
+		{
+			name:     "dry run",
+			opts:     ImportOptions{DryRun: true, UID: 1},
+			want:     Report{DryRun: true, Total: 6, Created: 1, Skipped: 2, Failed: 3},
+			takenURL: "https://example.com/old",
+		},
+		{
+			name:       "skip",
+			opts:       ImportOptions{Conflict: ConflictSkip, UID: 1},
+			want:       Report{Total: 6, Created: 1, Skipped: 2, Failed: 3},
+			takenURL:   "https://example.com/old",
+			freshSaved: true,
+		},
+		{
+			name:       "overwrite",
+			opts:       ImportOptions{Conflict: ConflictOverwrite, UID: 1, AnyOwner: AllowAnyOwner},
+			want:       Report{Total: 6, Created: 2, Overwritten: 2, Failed: 2},
+			takenURL:   "https://example.com/new",
+			freshSaved: true,
+		},
+		{
+			name:     "fail",
+			opts:     ImportOptions{Conflict: ConflictFail, UID: 1},
+			want:     Report{Total: 1, Failed: 1, Aborted: true},
+			takenURL: "https://example.com/old",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := memory.NewStorage()
+			require.NoError(t, s.SaveURL(ctx, "https://example.com/old", "taken", 1, 1, storage.SaveOptions{}))
+
+			r, err := NewReader(strings.NewReader(input), FormatCSV)
+			require.NoError(t, err)
+			report, err := NewImporter(s, policy).Import(ctx, r, tt.opts)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.Total, report.Total)
+			assert.Equal(t, tt.want.Created, report.Created)
+			assert.Equal(t, tt.want.Overwritten, report.Overwritten)
+			assert.Equal(t, tt.want.Skipped, report.Skipped)
+			assert.Equal(t, tt.want.Failed, report.Failed)
+			assert.Equal(t, tt.want.Aborted, report.Aborted)
+			assert.Len(t, report.Errors, report.Failed)
+
+			url, err := s.GetURL(ctx, "taken")
+			require.NoError(t, err)
+			assert.Equal(t, tt.takenURL, url)
+			_, err = s.GetURL(ctx, "fresh")
+			assert.Equal(t, tt.freshSaved, err == nil)
+		})
+	}
+
+	t.Run("owner checked once and only for links of others", func(t *testing.T) {
+		s := memory.NewStorage()
+		require.NoError(t, s.SaveURL(ctx, "https://example.com/old", "taken", 1, 1, storage.SaveOptions{}))
+		asked := 0
+		anyOwner := func(context.Context) (bool, error) {
+			asked++
+			return false, nil
+		}
+
+		r, err := NewReader(strings.NewReader("alias,url,owner\nmine,https://example.com,\n"), FormatCSV)
+		require.NoError(t, err)
+		_, err = NewImporter(s, policy).Import(ctx, r, ImportOptions{Conflict: ConflictOverwrite, UID: 1, AnyOwner: anyOwner})
+		require.NoError(t, err)
+		assert.Equal(t, 0, asked)
+
+		r, err = NewReader(strings.NewReader(input), FormatCSV)
+		require.NoError(t, err)
+		_, err = NewImporter(s, policy).Import(ctx, r, ImportOptions{Conflict: ConflictOverwrite, UID: 2, AnyOwner: anyOwner})
+		require.NoError(t, err)
+		assert.Equal(t, 1, asked)
+		url, err := s.GetURL(ctx, "taken")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/old", url)
+
+		failed := errors.New("sso is down")
+		r, err = NewReader(strings.NewReader(input), FormatCSV)
+		require.NoError(t, err)
+		_, err = NewImporter(s, policy).Import(ctx, r, ImportOptions{Conflict: ConflictOverwrite, UID: 2,
+			AnyOwner: func(context.Context) (bool, error) { return false, failed }})
+		assert.ErrorIs(t, err, failed)
+	})
+
+	t.Run("unknown conflict", func(t *testing.T) {
+		r, err := NewReader(strings.NewReader(input), FormatCSV)
+		require.NoError(t, err)
+		_, err = NewImporter(memory.NewStorage(), policy).Import(ctx, r, ImportOptions{Conflict: "merge"})
+		assert.ErrorIs(t, err, ErrUnknownConflict)
+	})
+}
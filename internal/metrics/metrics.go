@@ -0,0 +1,159 @@
+// Package metrics collects Prometheus metrics of the service.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "url_shortener"
+
+// Metrics registers everything in its own registry, so tests can create many of them
+type Metrics struct {
+	registry        *prometheus.Registry
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	ssoCallDuration *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status.",
+		}, []string{"route", "method", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route pattern and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Redirects by result: hit, miss (unknown alias) or gone (expired link).",
+		}, []string{"result"}),
+		ssoCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sso_grpc_call_duration_seconds",
+			Help:      "Latency of SSO gRPC calls by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.redirects,
+		m.ssoCallDuration,
+	)
+	return m
+}
+
+// Handler serves metrics for scraping
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests by chi route pattern, so /{alias} is one series whatever alias is.
+// It must be used by the chi router, the pattern is known only after routing.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// CountRedirect counts a redirect with result hit, miss or gone
+func (m *Metrics) CountRedirect(result string) {
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// UnaryClientInterceptor observes latency and status code of every gRPC call
+func (m *Metrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		m.ssoCallDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// RegisterAliasCollisions exposes collisions of generated aliases
+func (m *Metrics) RegisterAliasCollisions(collisions func() int64) {
+	m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alias_collisions_total",
+		Help:      "Generated aliases which were already taken.",
+	}, func() float64 { return float64(collisions()) }))
+}
+
+// RegisterCache exposes hits and misses of the link cache
+func (m *Metrics) RegisterCache(hits func() uint64, misses func() uint64) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "link_cache_hits_total",
+			Help:      "Links read by redirects from in-process cache.",
+		}, func() float64 { return float64(hits()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "link_cache_misses_total",
+			Help:      "Links read by redirects from shared cache or storage.",
+		}, func() float64 { return float64(misses()) }),
+	)
+}
+
+// RegisterClicks exposes counters of the clicks recorder
+func (m *Metrics) RegisterClicks(recorded func() uint64, dropped func() uint64, failed func() uint64) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_recorded_total",
+			Help:      "Clicks saved to storage.",
+		}, func() float64 { return float64(recorded()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_dropped_total",
+			Help:      "Clicks dropped because the buffer was full or the recorder was closed.",
+		}, func() float64 { return float64(dropped()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "clicks_failed_total",
+			Help:      "Clicks which storage failed to save.",
+		}, func() float64 { return float64(failed()) }),
+	)
+}
+
+// RegisterPool exposes stats of the Postgres pool
+func (m *Metrics) RegisterPool(stat func() *pgxpool.Stat) {
+	m.registry.MustRegister(newPoolCollector(stat))
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Route("/url", func(r chi.Router) {
+		r.Route("/{alias}", func(r chi.Router) {
+			r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+		})
+	})
+	router.Get("/{alias}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})
+
+	for _, path := range []string{"/habr", "/go", "/url/habr", "/url/habr/unknown/route", "/nothing/here"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/{alias}", "GET", "302")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/url/{alias}", "GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/url/{alias}/*", "GET", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("unmatched", "GET", "404")))
+	assert.Equal(t, 4, testutil.CollectAndCount(m.httpRequests))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	m := New()
+	interceptor := m.UnaryClientInterceptor()
+	invoke := func(err error) {
+		_ = interceptor(context.Background(), "/auth.Permissions/IsAdmin", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error { return err })
+	}
+	invoke(nil)
+	invoke(status.Error(codes.PermissionDenied, "denied"))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.ssoCallDuration))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.CountRedirect("hit")
+	m.RegisterAliasCollisions(func() int64 { return 3 })
+	m.RegisterClicks(func() uint64 { return 5 }, func() uint64 { return 1 }, func() uint64 { return 0 })
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`url_shortener_redirects_total{result="hit"} 1`,
+		`url_shortener_alias_collisions_total 3`,
+		`url_shortener_clicks_recorded_total 5`,
+		`url_shortener_clicks_dropped_total 1`,
+		`go_goroutines`,
+	} {
+		assert.True(t, strings.Contains(body, want), want)
+	}
+}
@@ -0,0 +1,277 @@
+// Package cache is a read-through cache of links for redirects in front of storage.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/lib/lru"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// entryOverhead is a rough size of an entry besides its strings
+const entryOverhead = 256
+
+// invalidateTimeout limits invalidation of shared cache after a write
+const invalidateTimeout = time.Second
+
+// ErrMiss is returned by Shared when it has no entry of the alias
+var ErrMiss = errors.New("cache miss")
+
+// Shared is a cache shared by all instances of the service, it sits between
+// in-process cache and storage. Changes of a link are published to all instances,
+// so every one of them drops the link from its in-process cache.
+type Shared interface {
+	Get(ctx context.Context, alias string) (Entry, error)
+	Set(ctx context.Context, alias string, e Entry, ttl time.Duration) error
+	Delete(ctx context.Context, alias string) error
+	// Publish tells all instances that the link of alias is changed
+	Publish(ctx context.Context, alias string) error
+	// Subscribe calls invalidate with every published alias until ctx is done
+	Subscribe(ctx context.Context, invalidate func(alias string)) error
+}
+
+type Options struct {
+	// Shared is optional, without it every instance reads storage on its own misses
+	Shared Shared
+	TTL    time.Duration
+	// unknown aliases are cached for NegativeTTL, zero disables it
+	NegativeTTL time.Duration
+	MaxEntries  int
+	MaxBytes    int64
+}
+
+// Stats are counters of GetURLInfo
+type Stats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+	Bytes   int64
+}
+
+// Entry is a link or a knowledge that there's no link with the alias
+type Entry struct {
+	Link  storage.URL `json:"link"`
+	Found bool        `json:"found"`
+}
+
+// Storage caches GetURLInfo of the next storage.
+// Writes go to the next storage and drop cached link of their alias.
+type Storage struct {
+	storage.URLStorage
+	log         *slog.Logger
+	shared      Shared
+	links       *lru.Cache[string, Entry]
+	group       singleflight.Group
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// generation changes on every invalidation, a link loaded
+	// before it may be stale and isn't cached
+	generation atomic.Uint64
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+}
+
+func New(log *slog.Logger, next storage.URLStorage, opts Options) *Storage {
+	return &Storage{
+		URLStorage: next,
+		log:        log,
+		shared:     opts.Shared,
+		links: lru.New(opts.MaxEntries, opts.MaxBytes, func(alias string, e Entry) int64 {
+			return int64(len(alias)+len(e.Link.URL)+len(e.Link.Alias)) + entryOverhead
+		}),
+		ttl:         opts.TTL,
+		negativeTTL: opts.NegativeTTL,
+	}
+}
+
+// GetURLInfo returns cached link, concurrent misses of the same alias load it once
+func (s *Storage) GetURLInfo(ctx context.Context, alias string) (storage.URL, error) {
+	const op = "storage.cache.GetURLInfo"
+
+	if e, ok := s.links.Get(alias); ok {
+		s.hits.Add(1)
+		if !e.Found {
+			return storage.URL{}, fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+		}
+		return e.Link, nil
+	}
+	s.misses.Add(1)
+
+	v, err, _ := s.group.Do(alias, func() (any, error) {
+		generation := s.generation.Load()
+		// the load is shared, so it must not be canceled with the first caller
+		e, err := s.load(context.WithoutCancel(ctx), alias, generation)
+		if err != nil {
+			return nil, err
+		}
+		if s.generation.Load() == generation {
+			s.links.Add(alias, e, s.entryTTL(e))
+		}
+		return e, nil
+	})
+	if err != nil {
+		return storage.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if e := v.(Entry); e.Found {
+		return e.Link, nil
+	}
+	return storage.URL{}, fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+}
+
+// load reads entry from shared cache and then from storage.
+// Shared cache is an optimization, its failures only fall back to storage.
+// The entry read from storage isn't written back to shared cache if anything
+// was invalidated since generation, it may be older than the write which
+// deleted the shared entry and would outlive it until ttl.
+func (s *Storage) load(ctx context.Context, alias string, generation uint64) (Entry, error) {
+	if s.shared != nil {
+		e, err := s.shared.Get(ctx, alias)
+		if err == nil {
+			return e, nil
+		}
+		if !errors.Is(err, ErrMiss) {
+			s.log.Warn("failed to get link from shared cache", sl.Err(err))
+		}
+	}
+
+	var e Entry
+	link, err := s.URLStorage.GetURLInfo(ctx, alias)
+	switch {
+	case err == nil:
+		e = Entry{Link: link, Found: true}
+	case errors.Is(err, storage.ErrURLNotFound):
+	default:
+		return Entry{}, err
+	}
+
+	if ttl := s.entryTTL(e); s.shared != nil && ttl > 0 && s.generation.Load() == generation {
+		if err := s.shared.Set(ctx, alias, e, ttl); err != nil {
+			s.log.Warn("failed to set link to shared cache", sl.Err(err))
+		}
+	}
+	return e, nil
+}
+
+func (s *Storage) entryTTL(e Entry) time.Duration {
+	if !e.Found {
+		return s.negativeTTL
+	}
+	return s.linkTTL(e.Link)
+}
+
+// linkTTL doesn't let a link outlive its expiration in cache
+func (s *Storage) linkTTL(link storage.URL) time.Duration {
+	ttl := s.ttl
+	if link.ExpiresAt != nil {
+		if left := time.Until(*link.ExpiresAt); left > 0 && left < ttl {
+			ttl = left
+		}
+	}
+	return ttl
+}
+
+// Invalidate drops cached link everywhere, the next GetURLInfo of any instance reads it from storage
+func (s *Storage) Invalidate(alias string) {
+	s.invalidateLocal(alias)
+	if s.shared == nil {
+		return
+	}
+	// writes are done, so invalidation mustn't be canceled with the request
+	ctx, cancel := context.WithTimeout(context.Background(), invalidateTimeout)
+	defer cancel()
+	if err := s.shared.Delete(ctx, alias); err != nil {
+		s.log.Error("failed to delete link from shared cache", slog.String("alias", alias), sl.Err(err))
+	}
+	if err := s.shared.Publish(ctx, alias); err != nil {
+		s.log.Error("failed to publish invalidation", slog.String("alias", alias), sl.Err(err))
+	}
+}
+
+// invalidateLocal drops link from in-process cache only
+func (s *Storage) invalidateLocal(alias string) {
+	s.generation.Add(1)
+	s.group.Forget(alias)
+	s.links.Remove(alias)
+}
+
+// Run drops links changed by other instances until ctx is done, it's a no-op without shared cache.
+// Invalidations published while subscription reconnects are lost, TTL limits staleness then.
+func (s *Storage) Run(ctx context.Context) {
+	const op = "storage.cache.Run"
+	log := s.log.With(slog.String("op", op))
+
+	if s.shared == nil {
+		return
+	}
+	for {
+		err := s.shared.Subscribe(ctx, s.invalidateLocal)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Error("invalidation subscription is broken", sl.Err(err))
+		// anything could change meanwhile
+		s.links.Purge()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Storage) Stats() Stats {
+	return Stats{
+		Hits:    s.hits.Load(),
+		Misses:  s.misses.Load(),
+		Entries: s.links.Len(),
+		Bytes:   s.links.Bytes(),
+	}
+}
+
+// new links drop cached absence of their aliases
+
+func (s *Storage) SaveURL(ctx context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts storage.SaveOptions) error {
+	defer s.Invalidate(alias)
+	return s.URLStorage.SaveURL(ctx, urlToSave, alias, ownerUID, appID, opts)
+}
+
+func (s *Storage) SaveURLs(ctx context.Context, urls []storage.NewURL) error {
+	defer func() {
+		for _, u := range urls {
+			s.Invalidate(u.Alias)
+		}
+	}()
+	return s.URLStorage.SaveURLs(ctx, urls)
+}
+
+func (s *Storage) UpdateURL(ctx context.Context, alias string, newURL string, changedBy uint64) error {
+	defer s.Invalidate(alias)
+	return s.URLStorage.UpdateURL(ctx, alias, newURL, changedBy)
+}
+
+func (s *Storage) RollbackURL(ctx context.Context, alias string, revisionID int64, changedBy uint64) (string, error) {
+	defer s.Invalidate(alias)
+	return s.URLStorage.RollbackURL(ctx, alias, revisionID, changedBy)
+}
+
+func (s *Storage) DeleteURL(ctx context.Context, alias string) error {
+	defer s.Invalidate(alias)
+	return s.URLStorage.DeleteURL(ctx, alias)
+}
+
+// ConsumeClick drops the link when its clicks are exhausted, the reloaded one is expired
+// without asking storage again. Links expired by time needn't that, expires_at is cached with them.
+func (s *Storage) ConsumeClick(ctx context.Context, alias string) error {
+	err := s.URLStorage.ConsumeClick(ctx, alias)
+	if errors.Is(err, storage.ErrURLExhausted) || errors.Is(err, storage.ErrURLNotFound) {
+		s.Invalidate(alias)
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts reads and can hold their results until release is closed
+type countingStorage struct {
+	storage.URLStorage
+	reads   atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingStorage) GetURLInfo(ctx context.Context, alias string) (storage.URL, error) {
+	s.reads.Add(1)
+	link, err := s.URLStorage.GetURLInfo(ctx, alias)
+	if s.release != nil {
+		<-s.release
+	}
+	return link, err
+}
+
+// mapShared is a shared cache of one instance
+type mapShared struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func (m *mapShared) Get(ctx context.Context, alias string) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[alias]
+	if !ok {
+		return Entry{}, ErrMiss
+	}
+	return e, nil
+}
+
+func (m *mapShared) Set(ctx context.Context, alias string, e Entry, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[alias] = e
+	return nil
+}
+
+func (m *mapShared) Delete(ctx context.Context, alias string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, alias)
+	return nil
+}
+
+func (m *mapShared) Publish(ctx context.Context, alias string) error { return nil }
+
+func (m *mapShared) Subscribe(ctx context.Context, invalidate func(alias string)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newStorage(t *testing.T) (*Storage, *countingStorage) {
+	next := &countingStorage{URLStorage: memory.NewStorage()}
+	s := New(slog.Default(), next, Options{TTL: time.Minute, NegativeTTL: time.Minute, MaxEntries: 100})
+	require.NoError(t, s.SaveURL(context.Background(), "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+	return s, next
+}
+
+func TestReadThrough(t *testing.T) {
+	ctx := context.Background()
+	s, next := newStorage(t)
+
+	for i := 0; i < 3; i++ {
+		link, err := s.GetURLInfo(ctx, "habr")
+		require.NoError(t, err)
+		assert.Equal(t, "https://habr.com/", link.URL)
+	}
+	assert.Equal(t, int64(1), next.reads.Load())
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Entries: 1, Bytes: s.links.Bytes()}, s.Stats())
+
+	require.NoError(t, s.UpdateURL(ctx, "habr", "https://go.dev/", 1))
+	link, err := s.GetURLInfo(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/", link.URL, "update invalidates link")
+
+	require.NoError(t, s.DeleteURL(ctx, "habr"))
+	_, err = s.GetURLInfo(ctx, "habr")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound, "delete invalidates link")
+}
+
+func TestNegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	s, next := newStorage(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetURLInfo(ctx, "unknown")
+		assert.ErrorIs(t, err, storage.ErrURLNotFound)
+	}
+	assert.Equal(t, int64(1), next.reads.Load())
+
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "unknown", 1, 1, storage.SaveOptions{}))
+	link, err := s.GetURLInfo(ctx, "unknown")
+	require.NoError(t, err, "save invalidates absence")
+	assert.Equal(t, "https://go.dev/", link.URL)
+}
+
+func TestConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	s, next := newStorage(t)
+	next.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			link, err := s.GetURLInfo(ctx, "habr")
+			assert.NoError(t, err)
+			assert.Equal(t, "https://habr.com/", link.URL)
+		}()
+	}
+	// let all goroutines join the load
+	time.Sleep(50 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), next.reads.Load())
+}
+
+func TestExpiringLink(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newStorage(t)
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "soon", 1, 1, storage.SaveOptions{ExpiresAt: &expiresAt}))
+
+	_, err := s.GetURLInfo(ctx, "soon")
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+	_, ok := s.links.Get("soon")
+	assert.False(t, ok, "link isn't cached longer than it lives")
+}
+
+func TestInvalidationDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	next := &countingStorage{URLStorage: memory.NewStorage(), release: make(chan struct{})}
+	shared := &mapShared{entries: make(map[string]Entry)}
+	s := New(slog.Default(), next, Options{Shared: shared, TTL: time.Minute, MaxEntries: 100})
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		link, err := s.GetURLInfo(ctx, "habr")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://habr.com/", link.URL)
+	}()
+	// update the link while the old one is being read
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, s.UpdateURL(ctx, "habr", "https://go.dev/", 1))
+	close(next.release)
+	<-done
+
+	_, err := shared.Get(ctx, "habr")
+	assert.ErrorIs(t, err, ErrMiss, "stale link isn't written back to shared cache")
+	link, err := s.GetURLInfo(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/", link.URL)
+	_, err = shared.Get(ctx, "habr")
+	assert.NoError(t, err, "fresh link is written back")
+}
@@ -0,0 +1,119 @@
+// Package redis is a shared cache of links in Redis or any server speaking its protocol.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/storage/cache"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Cache keeps entries as JSON under prefix+alias and publishes changed aliases to channel
+type Cache struct {
+	client  *goredis.Client
+	prefix  string
+	channel string
+}
+
+func New(ctx context.Context, address string, password string, db int, prefix string, channel string) (*Cache, error) {
+	const op = "storage.cache.redis.New"
+
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     address,
+		Password: password,
+		DB:       db,
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Cache{
+		client:  client,
+		prefix:  prefix,
+		channel: channel,
+	}, nil
+}
+
+func (c *Cache) Get(ctx context.Context, alias string) (cache.Entry, error) {
+	const op = "storage.cache.redis.Get"
+
+	b, err := c.client.Get(ctx, c.prefix+alias).Bytes()
+	if err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return cache.Entry{}, cache.ErrMiss
+		}
+		return cache.Entry{}, fmt.Errorf("%s: %w", op, err)
+	}
+	var e cache.Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return cache.Entry{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return e, nil
+}
+
+func (c *Cache) Set(ctx context.Context, alias string, e cache.Entry, ttl time.Duration) error {
+	const op = "storage.cache.redis.Set"
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := c.client.Set(ctx, c.prefix+alias, b, ttl).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (c *Cache) Delete(ctx context.Context, alias string) error {
+	const op = "storage.cache.redis.Delete"
+
+	if err := c.client.Del(ctx, c.prefix+alias).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (c *Cache) Publish(ctx context.Context, alias string) error {
+	const op = "storage.cache.redis.Publish"
+
+	if err := c.client.Publish(ctx, c.channel, alias).Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Subscribe returns nil when ctx is done and an error when subscription fails
+func (c *Cache) Subscribe(ctx context.Context, invalidate func(alias string)) error {
+	const op = "storage.cache.redis.Subscribe"
+
+	sub := c.client.Subscribe(ctx, c.channel)
+	defer sub.Close()
+	// wait for confirmation, so invalidations published after return of Receive aren't lost
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return fmt.Errorf("%s: subscription is closed", op)
+			}
+			invalidate(msg.Payload)
+		}
+	}
+}
+
+func (c *Cache) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/cache"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCache(t *testing.T, srv *miniredis.Miniredis) *Cache {
+	c, err := New(context.Background(), srv.Addr(), "", 0, "link:", "invalidate")
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	c := newCache(t, srv)
+
+	_, err := c.Get(ctx, "habr")
+	assert.ErrorIs(t, err, cache.ErrMiss)
+
+	e := cache.Entry{Link: storage.URL{ID: 1, Alias: "habr", URL: "https://habr.com/"}, Found: true}
+	require.NoError(t, c.Set(ctx, "habr", e, time.Minute))
+	got, err := c.Get(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, e, got)
+	assert.True(t, srv.Exists("link:habr"))
+
+	srv.FastForward(time.Minute)
+	_, err = c.Get(ctx, "habr")
+	assert.ErrorIs(t, err, cache.ErrMiss, "entry expires with ttl")
+
+	require.NoError(t, c.Set(ctx, "habr", e, time.Minute))
+	require.NoError(t, c.Delete(ctx, "habr"))
+	_, err = c.Get(ctx, "habr")
+	assert.ErrorIs(t, err, cache.ErrMiss)
+}
+
+func TestCrossInstanceInvalidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := miniredis.RunT(t)
+	db := memory.NewStorage()
+	require.NoError(t, db.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+
+	// two replicas share storage and redis
+	opts := cache.Options{TTL: time.Hour, NegativeTTL: time.Hour, MaxEntries: 100}
+	first := cache.New(slog.Default(), db, withShared(opts, newCache(t, srv)))
+	second := cache.New(slog.Default(), db, withShared(opts, newCache(t, srv)))
+	go first.Run(ctx)
+	go second.Run(ctx)
+	// wait for both subscriptions
+	require.Eventually(t, func() bool {
+		return len(srv.PubSubChannels("invalidate")) == 1 && srv.PubSubNumSub("invalidate")["invalidate"] == 2
+	}, time.Second, 10*time.Millisecond)
+
+	link, err := first.GetURLInfo(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, "https://habr.com/", link.URL)
+	// the second one gets it from redis
+	_, err = second.GetURLInfo(ctx, "habr")
+	require.NoError(t, err)
+
+	require.NoError(t, second.UpdateURL(ctx, "habr", "https://go.dev/", 1))
+	require.Eventually(t, func() bool {
+		link, err := first.GetURLInfo(ctx, "habr")
+		return err == nil && link.URL == "https://go.dev/"
+	}, time.Second, 10*time.Millisecond, "update reaches another replica")
+
+	require.NoError(t, second.DeleteURL(ctx, "habr"))
+	require.Eventually(t, func() bool {
+		_, err := first.GetURLInfo(ctx, "habr")
+		return err != nil
+	}, time.Second, 10*time.Millisecond, "delete reaches another replica")
+	_, err = first.GetURLInfo(ctx, "habr")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+}
+
+func withShared(opts cache.Options, shared cache.Shared) cache.Options {
+	opts.Shared = shared
+	return opts
+}
@@ -0,0 +1,441 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/storage"
+)
+
+// Storage keeps urls in process memory. It is safe for concurrent use
+// and loses everything on restart, so use it only for demos and tests.
+type Storage struct {
+	mu             sync.RWMutex
+	links          map[string]storage.URL
+	revisions      map[string][]storage.Revision
+	clicks         []savedClick
+	lastClickID    int64
+	rollups        map[rollupKey]storage.ClickRollup
+	archive        []storage.URL // expired links removed with archive
+	exhaustedAt    map[string]time.Time
+	lastID         int64
+	lastRevisionID int64
+}
+
+type savedClick struct {
+	storage.SavedClick
+	rolledUp bool
+}
+
+type rollupKey struct {
+	alias  string
+	bucket time.Time
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		links:       make(map[string]storage.URL),
+		revisions:   make(map[string][]storage.Revision),
+		rollups:     make(map[rollupKey]storage.ClickRollup),
+		exhaustedAt: make(map[string]time.Time),
+	}
+}
+
+func (s *Storage) CloseStorage() {}
+
+func (s *Storage) SaveURL(_ context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts storage.SaveOptions) error {
+	const op = "storage.memory.SaveURL"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[alias]; ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrURLExists)
+	}
+	s.insertURL(storage.NewURL{URL: urlToSave, Alias: alias, OwnerUID: ownerUID, AppID: appID, Opts: opts})
+	return nil
+}
+
+// SaveURLs checks all aliases before saving, so links are saved all or none
+func (s *Storage) SaveURLs(_ context.Context, urls []storage.NewURL) error {
+	const op = "storage.memory.SaveURLs"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool, len(urls))
+	for i, u := range urls {
+		if _, ok := s.links[u.Alias]; ok || seen[u.Alias] {
+			return fmt.Errorf("%s: %w", op, &storage.BatchError{Index: i, Err: storage.ErrURLExists})
+		}
+		seen[u.Alias] = true
+	}
+	for _, u := range urls {
+		s.insertURL(u)
+	}
+	return nil
+}
+
+// insertURL saves link with free alias, s.mu must be locked
+func (s *Storage) insertURL(u storage.NewURL) {
+	id := u.Opts.ID
+	if id == 0 {
+		s.lastID++
+		id = s.lastID
+	}
+	now := time.Now().UTC()
+	if !u.Opts.CreatedAt.IsZero() {
+		now = u.Opts.CreatedAt.UTC()
+	}
+	link := storage.URL{
+		ID:           id,
+		Alias:        u.Alias,
+		URL:          u.URL,
+		Host:         storage.URLHost(u.URL),
+		OwnerUID:     u.OwnerUID,
+		AppID:        u.AppID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		RedirectType: storage.DefaultRedirectType,
+		MaxClicks:    u.Opts.MaxClicks,
+	}
+	if u.Opts.ExpiresAt != nil {
+		expiresAt := u.Opts.ExpiresAt.UTC()
+		link.ExpiresAt = &expiresAt
+	}
+	s.links[u.Alias] = link
+}
+
+func (s *Storage) NextURLID(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	return s.lastID, nil
+}
+
+func (s *Storage) GetURL(_ context.Context, alias string) (string, error) {
+	const op = "storage.memory.GetURL"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, ok := s.links[alias]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+	}
+	return l.URL, nil
+}
+
+// GetURLOwner returns uid of the user who created the link.
+func (s *Storage) GetURLOwner(_ context.Context, alias string) (uint64, error) {
+	const op = "storage.memory.GetURLOwner"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, ok := s.links[alias]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+	}
+	return l.OwnerUID, nil
+}
+
+// GetURLInfo returns the whole link
+func (s *Storage) GetURLInfo(_ context.Context, alias string) (storage.URL, error) {
+	const op = "storage.memory.GetURLInfo"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, ok := s.links[alias]
+	if !ok {
+		return storage.URL{}, fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+	}
+	return l, nil
+}
+
+// ListURLs returns one page of links ordered by (created_at, id)
+func (s *Storage) ListURLs(_ context.Context, filter storage.ListFilter) ([]storage.URL, error) {
+	s.mu.RLock()
+	urls := make([]storage.URL, 0, len(s.links))
+	for _, l := range s.links {
+		if filter.OwnerUID != nil && l.OwnerUID != *filter.OwnerUID {
+			continue
+		}
+		if !strings.HasPrefix(l.Alias, filter.AliasPrefix) {
+			continue
+		}
+		if filter.Host != "" && l.Host != strings.ToLower(filter.Host) {
+			continue
+		}
+		if filter.After != nil && !after(l, *filter.After, filter.Asc) {
+			continue
+		}
+		urls = append(urls, l)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(urls, func(i, j int) bool {
+		return after(urls[j], storage.Cursor{CreatedAt: urls[i].CreatedAt, ID: urls[i].ID}, filter.Asc)
+	})
+	if len(urls) > filter.Limit {
+		urls = urls[:filter.Limit]
+	}
+	return urls, nil
+}
+
+// after reports whether link l goes after cursor c in the given order
+func after(l storage.URL, c storage.Cursor, asc bool) bool {
+	if !l.CreatedAt.Equal(c.CreatedAt) {
+		return l.CreatedAt.After(c.CreatedAt) == asc
+	}
+	if l.ID == c.ID {
+		return false
+	}
+	return (l.ID > c.ID) == asc
+}
+
+// UpdateURL changes destination of the link and keeps the previous one as a revision
+func (s *Storage) UpdateURL(_ context.Context, alias string, newURL string, changedBy uint64) error {
+	const op = "storage.memory.UpdateURL"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.replaceURL(alias, newURL, changedBy); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ListURLRevisions returns previous destinations of the link, newest first
+func (s *Storage) ListURLRevisions(_ context.Context, alias string) ([]storage.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revs := s.revisions[alias]
+	revisions := make([]storage.Revision, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		revisions = append(revisions, revs[i])
+	}
+	return revisions, nil
+}
+
+// RollbackURL restores destination from the revision and returns it.
+// The replaced destination becomes a new revision, so rollback can be undone.
+func (s *Storage) RollbackURL(_ context.Context, alias string, revisionID int64, changedBy uint64) (string, error) {
+	const op = "storage.memory.RollbackURL"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rev := range s.revisions[alias] {
+		if rev.ID != revisionID {
+			continue
+		}
+		if err := s.replaceURL(alias, rev.URL, changedBy); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		return rev.URL, nil
+	}
+	return "", fmt.Errorf("%s: %w", op, storage.ErrRevisionNotFound)
+}
+
+// replaceURL must be called with s.mu locked
+func (s *Storage) replaceURL(alias string, newURL string, changedBy uint64) error {
+	l, ok := s.links[alias]
+	if !ok {
+		return storage.ErrURLNotFound
+	}
+
+	now := time.Now().UTC()
+	s.lastRevisionID++
+	s.revisions[alias] = append(s.revisions[alias], storage.Revision{
+		ID:        s.lastRevisionID,
+		URL:       l.URL,
+		ChangedBy: changedBy,
+		ChangedAt: now,
+	})
+
+	l.URL = newURL
+	l.Host = storage.URLHost(newURL)
+	l.UpdatedAt = now
+	s.links[alias] = l
+	return nil
+}
+
+func (s *Storage) DeleteURL(_ context.Context, alias string) error {
+	const op = "storage.memory.DeleteURL"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[alias]; !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+	}
+	s.deleteLink(alias)
+	return nil
+}
+
+// deleteLink removes link with its clicks and stats, so a link saved later
+// with the same alias starts without them, s.mu must be locked
+func (s *Storage) deleteLink(alias string) {
+	delete(s.links, alias)
+	delete(s.revisions, alias)
+	delete(s.exhaustedAt, alias)
+	s.clicks = slices.DeleteFunc(s.clicks, func(c savedClick) bool { return c.Alias == alias })
+	for key := range s.rollups {
+		if key.alias == alias {
+			delete(s.rollups, key)
+		}
+	}
+}
+
+// ConsumeClick counts a redirect against max clicks of the link.
+// It returns storage.ErrURLExhausted if no clicks are left.
+func (s *Storage) ConsumeClick(_ context.Context, alias string) error {
+	const op = "storage.memory.ConsumeClick"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[alias]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+	}
+	if l.MaxClicks > 0 && l.UsedClicks >= l.MaxClicks {
+		return fmt.Errorf("%s: %w", op, storage.ErrURLExhausted)
+	}
+	l.UsedClicks++
+	s.links[alias] = l
+	if l.MaxClicks > 0 && l.UsedClicks >= l.MaxClicks {
+		s.exhaustedAt[alias] = time.Now()
+	}
+	return nil
+}
+
+// DeleteExpiredURLs removes links expired or exhausted before cutoff with their clicks and stats
+func (s *Storage) DeleteExpiredURLs(_ context.Context, cutoff time.Time, archive bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for alias, l := range s.links {
+		exhaustedAt, exhausted := s.exhaustedAt[alias]
+		if !(l.ExpiresAt != nil && l.ExpiresAt.Before(cutoff)) && !(exhausted && exhaustedAt.Before(cutoff)) {
+			continue
+		}
+		if archive {
+			s.archive = append(s.archive, l)
+		}
+		s.deleteLink(alias)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// SaveClicks keeps clicks and adds them to link totals, clicks of deleted links are dropped
+func (s *Storage) SaveClicks(_ context.Context, clicks []storage.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range clicks {
+		l, ok := s.links[c.Alias]
+		if !ok {
+			continue
+		}
+		l.Clicks++
+		s.links[c.Alias] = l
+		s.lastClickID++
+		s.clicks = append(s.clicks, savedClick{SavedClick: storage.SavedClick{ID: s.lastClickID, Click: c}})
+	}
+	return nil
+}
+
+func (s *Storage) RollupClicks(_ context.Context, limit int, fold func([]storage.SavedClick) []storage.ClickRollup) (int, error) {
+	const op = "storage.memory.RollupClicks"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		clicks  []storage.SavedClick
+		indexes []int
+	)
+	for i := 0; i < len(s.clicks) && len(clicks) < limit; i++ {
+		if !s.clicks[i].rolledUp {
+			clicks = append(clicks, s.clicks[i].SavedClick)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(clicks) == 0 {
+		return 0, nil
+	}
+
+	rollups := fold(clicks)
+	// merge first, a failed merge claims nothing
+	merged := make(map[rollupKey]storage.ClickRollup, len(rollups))
+	for _, r := range rollups {
+		key := rollupKey{alias: r.Alias, bucket: r.Bucket.UTC()}
+		stored, ok := merged[key]
+		if !ok {
+			stored, ok = s.rollups[key]
+			stored.Referrers = maps.Clone(stored.Referrers)
+			stored.UserAgents = maps.Clone(stored.UserAgents)
+		}
+		if !ok {
+			stored = storage.ClickRollup{
+				Alias:      r.Alias,
+				Bucket:     key.bucket,
+				Referrers:  make(map[string]int64),
+				UserAgents: make(map[string]int64),
+			}
+		}
+		visitors, err := hll.MergeBytes(stored.Visitors, r.Visitors)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		stored.Visitors = visitors // MergeBytes never changes its arguments
+		stored.Clicks += r.Clicks
+		for referrer, clicks := range r.Referrers {
+			stored.Referrers[referrer] += clicks
+		}
+		for family, clicks := range r.UserAgents {
+			stored.UserAgents[family] += clicks
+		}
+		merged[key] = stored
+	}
+	for key, r := range merged {
+		s.rollups[key] = r
+	}
+	for _, i := range indexes {
+		s.clicks[i].rolledUp = true
+	}
+	return len(clicks), nil
+}
+
+func (s *Storage) ListClickRollups(_ context.Context, alias string, from time.Time, to time.Time) ([]storage.ClickRollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rollups []storage.ClickRollup
+	for key, r := range s.rollups {
+		if key.alias != alias || key.bucket.Before(from) || !key.bucket.Before(to) {
+			continue
+		}
+		// callers may change maps of rollups, return copies
+		r.Referrers = maps.Clone(r.Referrers)
+		r.UserAgents = maps.Clone(r.UserAgents)
+		rollups = append(rollups, r)
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Bucket.Before(rollups[j].Bucket) })
+	return rollups, nil
+}
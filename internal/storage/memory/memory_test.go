@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/clicks"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+	assert.ErrorIs(t, s.SaveURL(ctx, "https://go.dev/", "habr", 1, 1, storage.SaveOptions{}), storage.ErrURLExists)
+
+	resURL, err := s.GetURL(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, "https://habr.com/", resURL)
+
+	ownerUID, err := s.GetURLOwner(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), ownerUID)
+
+	_, err = s.GetURL(ctx, "unknown")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+
+	require.NoError(t, s.DeleteURL(ctx, "habr"))
+	assert.ErrorIs(t, s.DeleteURL(ctx, "habr"), storage.ErrAliasNotFound)
+
+	_, err = s.GetURL(ctx, "habr")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+}
+
+func TestStorageConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			alias := fmt.Sprintf("alias%d", i%10)
+			_ = s.SaveURL(ctx, "https://go.dev/", alias, 1, 1, storage.SaveOptions{})
+			_, _ = s.GetURL(ctx, alias)
+			_ = s.DeleteURL(ctx, alias)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestListURLs(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.SaveURL(ctx, "https://go.dev/", fmt.Sprintf("go%d", i), 1, 1, storage.SaveOptions{}))
+	}
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "other", 2, 1, storage.SaveOptions{}))
+
+	owner := uint64(1)
+	var aliases []string
+	filter := storage.ListFilter{OwnerUID: &owner, AliasPrefix: "go", Host: "go.dev", Limit: 2}
+	for {
+		page, err := s.ListURLs(ctx, filter)
+		require.NoError(t, err)
+		for _, u := range page {
+			aliases = append(aliases, u.Alias)
+		}
+		if len(page) < filter.Limit {
+			break
+		}
+		last := page[len(page)-1]
+		filter.After = &storage.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	assert.Equal(t, []string{"go4", "go3", "go2", "go1", "go0"}, aliases)
+}
+
+func TestURLRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/v1", "go", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.UpdateURL(ctx, "go", "https://go.dev/v2", 2))
+
+	revisions, err := s.ListURLRevisions(ctx, "go")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "https://go.dev/v1", revisions[0].URL)
+	assert.Equal(t, uint64(2), revisions[0].ChangedBy)
+
+	restored, err := s.RollbackURL(ctx, "go", revisions[0].ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/v1", restored)
+
+	revisions, err = s.ListURLRevisions(ctx, "go")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, "https://go.dev/v2", revisions[0].URL)
+
+	_, err = s.RollbackURL(ctx, "go", 100, 1)
+	assert.ErrorIs(t, err, storage.ErrRevisionNotFound)
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "dated", 1, 1, storage.SaveOptions{ExpiresAt: &expiresAt}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "limited", 1, 1, storage.SaveOptions{MaxClicks: 1}))
+	require.NoError(t, s.ConsumeClick(ctx, "limited"))
+	assert.ErrorIs(t, s.ConsumeClick(ctx, "limited"), storage.ErrURLExhausted)
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{{Alias: "limited", ClickedAt: bucket}}))
+	_, err := s.RollupClicks(ctx, 10, clicks.Rollup)
+	require.NoError(t, err)
+
+	// exhausted link is kept for grace like an expired one
+	deleted, err := s.DeleteExpiredURLs(ctx, time.Now().Add(-time.Minute), false)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	deleted, err = s.DeleteExpiredURLs(ctx, time.Now().Add(time.Second), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = s.GetURL(ctx, "limited")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+	// the alias is reissued without stats of the purged link
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "limited", 2, 1, storage.SaveOptions{}))
+	rollups, err := s.ListClickRollups(ctx, "limited", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+
+	deleted, err = s.DeleteExpiredURLs(ctx, expiresAt.Add(time.Second), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestDeleteURLClicks(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "go", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{
+		{Alias: "go", ClickedAt: bucket, IPHash: "a"},
+		{Alias: "go", ClickedAt: bucket, IPHash: "b"},
+	}))
+	// one click is in stats, the other is waiting for aggregation
+	n, err := s.RollupClicks(ctx, 1, clicks.Rollup)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, s.DeleteURL(ctx, "go"))
+	// clicks buffered before the delete are flushed after it
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{{Alias: "go", ClickedAt: bucket}}))
+
+	// another user takes the alias and sees no clicks of the deleted link
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "go", 2, 1, storage.SaveOptions{}))
+	n, err = s.RollupClicks(ctx, 10, clicks.Rollup)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	rollups, err := s.ListClickRollups(ctx, "go", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+	info, err := s.GetURLInfo(ctx, "go")
+	require.NoError(t, err)
+	assert.Zero(t, info.Clicks)
+}
@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"github.com/neepooha/url_shortener/internal/config"
 	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/tracing"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -22,7 +27,14 @@ func NewStorage(cfg *config.Config) (*Storage, error) {
 		"password=%s dbname=%s sslmode=disable",
 		cfg.Storage.Host, cfg.Storage.Port, cfg.Storage.User, cfg.Storage.Password, cfg.Storage.Dbname)
 
-	db, err := pgxpool.New(context.Background(), psqlInfo)
+	poolConfig, err := pgxpool.ParseConfig(psqlInfo)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// queries are spans of the request, it's a no-op when tracing is off
+	poolConfig.ConnConfig.Tracer = tracing.NewQueryTracer()
+
+	db, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -33,20 +45,77 @@ func (s *Storage) CloseStorage() {
 	s.db.Close()
 }
 
-func (s *Storage) SaveURL(ctx context.Context, urlToSave string, alias string) error {
+func (s *Storage) SaveURL(ctx context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts storage.SaveOptions) error {
 	const op = "storage.postgres.SaveURL"
 
-	stmt := `INSERT INTO urls (url, alias) VALUES($1, $2)`
-	_, err := s.db.Exec(ctx, stmt, urlToSave, alias)
+	err := insertURL(ctx, s.db, storage.NewURL{URL: urlToSave, Alias: alias, OwnerUID: ownerUID, AppID: appID, Opts: opts})
 	if err != nil {
-		if IsDuplicatedKeyError(err) {
-			return fmt.Errorf("%s: %w", op, storage.ErrURLExists)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) SaveURLs(ctx context.Context, urls []storage.NewURL) error {
+	const op = "storage.postgres.SaveURLs"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		for i, u := range urls {
+			if err := insertURL(ctx, tx, u); err != nil {
+				return &storage.BatchError{Index: i, Err: err}
+			}
 		}
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	return nil
 }
 
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+// Stat returns stats of the connection pool
+func (s *Storage) Stat() *pgxpool.Stat {
+	return s.db.Stat()
+}
+
+// execer is pool or transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func insertURL(ctx context.Context, db execer, u storage.NewURL) error {
+	stmt := `INSERT INTO urls (id, url, alias, owner_uid, app_id, host, expires_at, max_clicks, created_at, updated_at)
+		VALUES(COALESCE(NULLIF($1::bigint, 0), nextval(pg_get_serial_sequence('urls', 'id'))),
+			$2, $3, $4, $5, $6, $7, NULLIF($8, 0), COALESCE($9::timestamptz, now()), COALESCE($9::timestamptz, now()))`
+	var createdAt *time.Time
+	if !u.Opts.CreatedAt.IsZero() {
+		createdAt = &u.Opts.CreatedAt
+	}
+	_, err := db.Exec(ctx, stmt, u.Opts.ID, u.URL, u.Alias, int64(u.OwnerUID), u.AppID, storage.URLHost(u.URL),
+		u.Opts.ExpiresAt, u.Opts.MaxClicks, createdAt)
+	if err != nil {
+		if IsDuplicatedKeyError(err) {
+			return storage.ErrURLExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) NextURLID(ctx context.Context) (int64, error) {
+	const op = "storage.postgres.NextURLID"
+
+	var id int64
+	err := s.db.QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('urls', 'id'))`).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
 func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
 	const op = "storage.postgres.GetURL"
 
@@ -63,29 +132,391 @@ func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
 	return resURL, nil
 }
 
+// GetURLOwner returns uid of the user who created the link.
+// Links created before ownership was recorded have owner 0.
+func (s *Storage) GetURLOwner(ctx context.Context, alias string) (uint64, error) {
+	const op = "storage.postgres.GetURLOwner"
+
+	stmt := `SELECT COALESCE(owner_uid, 0) FROM urls WHERE alias = $1`
+	var ownerUID int64
+	err := s.db.QueryRow(ctx, stmt, alias).Scan(&ownerUID)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uint64(ownerUID), nil
+}
+
+// GetURLInfo returns the whole link row
+func (s *Storage) GetURLInfo(ctx context.Context, alias string) (storage.URL, error) {
+	const op = "storage.postgres.GetURLInfo"
+
+	stmt := `SELECT ` + urlColumns + ` FROM urls WHERE alias = $1`
+	u, err := scanURL(s.db.QueryRow(ctx, stmt, alias))
+	if err != nil {
+		if IsNotFoundError(err) {
+			return storage.URL{}, fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+		}
+		return storage.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return u, nil
+}
+
+// ListURLs returns one page of links using keyset pagination over (created_at, id)
+func (s *Storage) ListURLs(ctx context.Context, filter storage.ListFilter) ([]storage.URL, error) {
+	const op = "storage.postgres.ListURLs"
+
+	var (
+		conds []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.OwnerUID != nil {
+		conds = append(conds, "owner_uid = "+arg(int64(*filter.OwnerUID)))
+	}
+	if filter.AliasPrefix != "" {
+		conds = append(conds, "alias LIKE "+arg(escapeLike(filter.AliasPrefix)+"%")+` ESCAPE '\'`)
+	}
+	if filter.Host != "" {
+		conds = append(conds, "host = "+arg(strings.ToLower(filter.Host)))
+	}
+	order, cmp := "DESC", "<"
+	if filter.Asc {
+		order, cmp = "ASC", ">"
+	}
+	if filter.After != nil {
+		conds = append(conds, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(filter.After.CreatedAt), arg(filter.After.ID)))
+	}
+
+	stmt := `SELECT ` + urlColumns + ` FROM urls`
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+	stmt += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT %s", order, order, arg(filter.Limit))
+
+	rows, err := s.db.Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var urls []storage.URL
+	for rows.Next() {
+		u, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		urls = append(urls, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return urls, nil
+}
+
+// UpdateURL changes destination of the link and keeps the previous one in url_revisions
+func (s *Storage) UpdateURL(ctx context.Context, alias string, newURL string, changedBy uint64) error {
+	const op = "storage.postgres.UpdateURL"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		return replaceURL(ctx, tx, alias, newURL, changedBy)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ListURLRevisions returns previous destinations of the link, newest first
+func (s *Storage) ListURLRevisions(ctx context.Context, alias string) ([]storage.Revision, error) {
+	const op = "storage.postgres.ListURLRevisions"
+
+	stmt := `SELECT r.id, r.url, r.changed_by, r.changed_at FROM url_revisions r
+		JOIN urls u ON u.id = r.url_id WHERE u.alias = $1 ORDER BY r.id DESC`
+	rows, err := s.db.Query(ctx, stmt, alias)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var revisions []storage.Revision
+	for rows.Next() {
+		var (
+			rev       storage.Revision
+			changedBy int64
+		)
+		if err := rows.Scan(&rev.ID, &rev.URL, &changedBy, &rev.ChangedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		rev.ChangedBy = uint64(changedBy)
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return revisions, nil
+}
+
+// RollbackURL restores destination from the revision and returns it.
+// The replaced destination becomes a new revision, so rollback can be undone.
+func (s *Storage) RollbackURL(ctx context.Context, alias string, revisionID int64, changedBy uint64) (string, error) {
+	const op = "storage.postgres.RollbackURL"
+
+	var restored string
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		stmt := `SELECT r.url FROM url_revisions r
+			JOIN urls u ON u.id = r.url_id WHERE u.alias = $1 AND r.id = $2`
+		err := tx.QueryRow(ctx, stmt, alias, revisionID).Scan(&restored)
+		if err != nil {
+			if IsNotFoundError(err) {
+				return storage.ErrRevisionNotFound
+			}
+			return err
+		}
+		return replaceURL(ctx, tx, alias, restored, changedBy)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return restored, nil
+}
+
+func replaceURL(ctx context.Context, tx pgx.Tx, alias string, newURL string, changedBy uint64) error {
+	var (
+		id     int64
+		oldURL string
+	)
+	err := tx.QueryRow(ctx, `SELECT id, url FROM urls WHERE alias = $1 FOR UPDATE`, alias).Scan(&id, &oldURL)
+	if err != nil {
+		if IsNotFoundError(err) {
+			return storage.ErrURLNotFound
+		}
+		return err
+	}
+
+	stmt := `INSERT INTO url_revisions (url_id, url, changed_by) VALUES($1, $2, $3)`
+	if _, err := tx.Exec(ctx, stmt, id, oldURL, int64(changedBy)); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE urls SET url = $1, host = $2, updated_at = now() WHERE id = $3`
+	if _, err := tx.Exec(ctx, stmt, newURL, storage.URLHost(newURL), id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteURL removes the link with its clicks and stats
 func (s *Storage) DeleteURL(ctx context.Context, alias string) error {
 	const op = "storage.postgres.DeleteURL"
 
-	stmt := `DELETE FROM urls WHERE alias = $1`
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		stmt := `DELETE FROM urls WHERE alias = $1`
+		res, err := tx.Exec(ctx, stmt, alias)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return storage.ErrAliasNotFound
+		}
+		return deleteClicks(ctx, tx, []string{alias})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// deleteClicks removes clicks and rollups of deleted links,
+// so a link saved later with the same alias starts without stats
+func deleteClicks(ctx context.Context, tx pgx.Tx, aliases []string) error {
+	if len(aliases) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, table := range []string{"clicks", "click_rollups", "click_referrer_rollups", "click_agent_rollups"} {
+		batch.Queue(`DELETE FROM `+table+` WHERE alias = ANY($1)`, aliases)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// ConsumeClick counts a redirect against max_clicks of the link.
+// It returns storage.ErrURLExhausted if no clicks are left.
+func (s *Storage) ConsumeClick(ctx context.Context, alias string) error {
+	const op = "storage.postgres.ConsumeClick"
+
+	// the last click starts grace of the link before purge
+	stmt := `UPDATE urls SET used_clicks = used_clicks + 1,
+			exhausted_at = CASE WHEN used_clicks + 1 >= max_clicks THEN now() ELSE exhausted_at END
+		WHERE alias = $1 AND (max_clicks IS NULL OR used_clicks < max_clicks)`
 	res, err := s.db.Exec(ctx, stmt, alias)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	affect := res.RowsAffected()
-	if affect == 0 {
-		return fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+	if res.RowsAffected() == 0 {
+		_, err := s.GetURLOwner(ctx, alias)
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %w", op, storage.ErrURLExhausted)
 	}
 	return nil
 }
 
+// DeleteExpiredURLs removes links expired or exhausted before cutoff with their clicks and stats.
+// With archive they are moved to urls_archive.
+func (s *Storage) DeleteExpiredURLs(ctx context.Context, cutoff time.Time, archive bool) (int64, error) {
+	const op = "storage.postgres.DeleteExpiredURLs"
+
+	stmt := `DELETE FROM urls WHERE expires_at < $1 OR exhausted_at < $1 RETURNING alias`
+	if archive {
+		stmt = `WITH deleted AS (DELETE FROM urls WHERE expires_at < $1 OR exhausted_at < $1
+			RETURNING id, alias, url, owner_uid, app_id, created_at, expires_at, max_clicks, used_clicks, clicks),
+		archived AS (INSERT INTO urls_archive (id, alias, url, owner_uid, app_id, created_at, expires_at, max_clicks, used_clicks, clicks)
+			SELECT * FROM deleted)
+		SELECT alias FROM deleted`
+	}
+	var deleted int64
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, stmt, cutoff)
+		if err != nil {
+			return err
+		}
+		aliases, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		deleted = int64(len(aliases))
+		return deleteClicks(ctx, tx, aliases)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return deleted, nil
+}
+
+// SaveClicks inserts clicks in one round trip and adds them to urls.clicks totals.
+// Clicks of links deleted meanwhile are dropped, they would be stats of the next link with the alias.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []storage.Click) error {
+	const op = "storage.postgres.SaveClicks"
+
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		// links are locked in the order of updates below, DeleteURL waits for the clicks
+		aliases := make([]string, 0, len(clicks))
+		for _, total := range clickTotals(clicks) {
+			aliases = append(aliases, total.alias)
+		}
+		rows, err := tx.Query(ctx, `SELECT alias FROM urls WHERE alias = ANY($1) ORDER BY alias FOR NO KEY UPDATE`, aliases)
+		if err != nil {
+			return err
+		}
+		live, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		clicks = liveClicks(clicks, live)
+		if len(clicks) == 0 {
+			return nil
+		}
+
+		columns := []string{"alias", "clicked_at", "referrer", "user_agent", "ip_hash", "request_id"}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"clicks"}, columns,
+			pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+				c := clicks[i]
+				return []any{c.Alias, c.ClickedAt, c.Referrer, c.UserAgent, c.IPHash, c.RequestID}, nil
+			}),
+		)
+		if err != nil {
+			return err
+		}
+
+		batch := &pgx.Batch{}
+		for _, total := range clickTotals(clicks) {
+			batch.Queue(`UPDATE urls SET clicks = clicks + $1 WHERE alias = $2`, total.count, total.alias)
+		}
+		return tx.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// liveClicks returns clicks of aliases in live
+func liveClicks(clicks []storage.Click, live []string) []storage.Click {
+	isLive := make(map[string]bool, len(live))
+	for _, alias := range live {
+		isLive[alias] = true
+	}
+	kept := make([]storage.Click, 0, len(clicks))
+	for _, c := range clicks {
+		if isLive[c.Alias] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+type clickTotal struct {
+	alias string
+	count int64
+}
+
+// clickTotals counts clicks per alias, sorted by alias so concurrent updates lock rows in the same order
+func clickTotals(clicks []storage.Click) []clickTotal {
+	counts := make(map[string]int64)
+	for _, c := range clicks {
+		counts[c.Alias]++
+	}
+	totals := make([]clickTotal, 0, len(counts))
+	for alias, count := range counts {
+		totals = append(totals, clickTotal{alias: alias, count: count})
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].alias < totals[j].alias })
+	return totals
+}
+
+// uniqueViolation is SQLSTATE of duplicated key
+const uniqueViolation = "23505"
+
 func IsDuplicatedKeyError(err error) bool {
 	var perr *pgconn.PgError
 	if errors.As(err, &perr) {
-		return perr.Code == "23505" // error code of duplicate
+		return perr.Code == uniqueViolation
 	}
 	return false
 }
 
+// urlColumns are columns read by scanURL
+const urlColumns = `id, alias, url, host, COALESCE(owner_uid, 0), COALESCE(app_id, 0),
+	created_at, updated_at, redirect_type, clicks, expires_at, COALESCE(max_clicks, 0), used_clicks`
+
+func scanURL(row pgx.Row) (storage.URL, error) {
+	var (
+		u        storage.URL
+		ownerUID int64
+	)
+	err := row.Scan(&u.ID, &u.Alias, &u.URL, &u.Host, &ownerUID, &u.AppID,
+		&u.CreatedAt, &u.UpdatedAt, &u.RedirectType, &u.Clicks, &u.ExpiresAt, &u.MaxClicks, &u.UsedClicks)
+	u.OwnerUID = uint64(ownerUID)
+	return u, err
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func IsNotFoundError(err error) bool {
-	return err.Error() == "no rows in result set"
+	return errors.Is(err, pgx.ErrNoRows)
 }
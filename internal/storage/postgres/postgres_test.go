@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/neepooha/url_shortener/internal/clicks"
+	"github.com/neepooha/url_shortener/internal/config"
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/lib/migrator"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStorage connects to a disposable database from PG_TEST_* variables,
+// tables of the service are truncated
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+
+	host := os.Getenv("PG_TEST_HOST")
+	if host == "" {
+		t.Skip("PG_TEST_HOST is not set")
+	}
+	cfg := &config.Config{Storage: config.Storage{
+		Driver:          storage.DriverPostgres,
+		Host:            host,
+		Port:            os.Getenv("PG_TEST_PORT"),
+		Dbname:          os.Getenv("PG_TEST_DBNAME"),
+		User:            os.Getenv("PG_TEST_USER"),
+		Password:        os.Getenv("PG_TEST_PASSWORD"),
+		Migrations_path: "../../../migrations",
+	}}
+	if err := migrator.Migrate(cfg); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		require.NoError(t, err)
+	}
+
+	s, err := NewStorage(cfg)
+	require.NoError(t, err)
+	t.Cleanup(s.CloseStorage)
+	_, err = s.db.Exec(context.Background(), `TRUNCATE urls, url_revisions, urls_archive,
+		clicks, click_rollups, click_referrer_rollups, click_agent_rollups`)
+	require.NoError(t, err)
+	return s
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "dated", 1, 1, storage.SaveOptions{ExpiresAt: &expiresAt}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "limited", 1, 1, storage.SaveOptions{MaxClicks: 1}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "forever", 1, 1, storage.SaveOptions{}))
+
+	require.NoError(t, s.ConsumeClick(ctx, "limited"))
+	assert.ErrorIs(t, s.ConsumeClick(ctx, "limited"), storage.ErrURLExhausted)
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{{Alias: "limited", ClickedAt: bucket}}))
+	_, err := s.RollupClicks(ctx, 10, clicks.Rollup)
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.ConsumeClick(ctx, "unknown"), storage.ErrURLNotFound)
+	require.NoError(t, s.ConsumeClick(ctx, "forever"))
+
+	// exhausted link is kept for grace like an expired one
+	deleted, err := s.DeleteExpiredURLs(ctx, time.Now().Add(-time.Minute), true)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	deleted, err = s.DeleteExpiredURLs(ctx, time.Now().Add(time.Second), true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = s.GetURL(ctx, "limited")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+	// the alias is reissued without stats of the purged link
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "limited", 2, 1, storage.SaveOptions{}))
+	rollups, err := s.ListClickRollups(ctx, "limited", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+
+	deleted, err = s.DeleteExpiredURLs(ctx, expiresAt.Add(time.Second), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = s.GetURL(ctx, "forever")
+	assert.NoError(t, err)
+
+	var archived int
+	require.NoError(t, s.db.QueryRow(ctx, `SELECT COUNT(*) FROM urls_archive`).Scan(&archived))
+	assert.Equal(t, 1, archived)
+}
+
+func TestRollupClicks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	bucket := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+	// a replica takes an id and commits its click later
+	var lateID int64
+	require.NoError(t, s.db.QueryRow(ctx, `SELECT nextval('clicks_id_seq')`).Scan(&lateID))
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{
+		{Alias: "habr", ClickedAt: bucket.Add(time.Minute)},
+		{Alias: "habr", ClickedAt: bucket.Add(2 * time.Minute)},
+	}))
+
+	var claimed int
+	fold := func(clicks []storage.SavedClick) []storage.ClickRollup {
+		claimed += len(clicks)
+		return []storage.ClickRollup{{
+			Alias:      "habr",
+			Bucket:     bucket,
+			Clicks:     int64(len(clicks)),
+			Referrers:  map[string]int64{"direct": int64(len(clicks))},
+			UserAgents: map[string]int64{"Chrome": int64(len(clicks))},
+			Visitors:   hll.New(),
+		}}
+	}
+	n, err := s.RollupClicks(ctx, 10, fold)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// the late click has a lower id than rolled up ones and is still counted
+	_, err = s.db.Exec(ctx, `INSERT INTO clicks (id, alias, clicked_at) VALUES ($1, 'habr', $2)`, lateID, bucket)
+	require.NoError(t, err)
+	n, err = s.RollupClicks(ctx, 10, fold)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	rollups, err := s.ListClickRollups(ctx, "habr", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, int64(claimed), rollups[0].Clicks)
+	assert.Equal(t, map[string]int64{"direct": 3}, rollups[0].Referrers)
+}
+
+func TestRollupClicksConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	bucket := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/", "habr", 1, 1, storage.SaveOptions{}))
+	want := hll.New()
+	var saved []storage.Click
+	for i := 0; i < 40; i++ {
+		ip := fmt.Sprintf("ip%d", i)
+		want.Add(ip)
+		saved = append(saved, storage.Click{Alias: "habr", ClickedAt: bucket, IPHash: ip})
+	}
+	require.NoError(t, s.SaveClicks(ctx, saved))
+
+	// aggregators flush the same bucket at once, one click each
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n, err := s.RollupClicks(ctx, 1, clicks.Rollup)
+				if !assert.NoError(t, err) || n == 0 {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	rollups, err := s.ListClickRollups(ctx, "habr", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.Equal(t, int64(len(saved)), rollups[0].Clicks)
+	assert.Equal(t, []byte(want), rollups[0].Visitors, "no visitor is lost")
+}
+
+func TestDeleteURLClicks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "go", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{
+		{Alias: "go", ClickedAt: bucket, IPHash: "a"},
+		{Alias: "go", ClickedAt: bucket, IPHash: "b"},
+	}))
+	// one click is in stats, the other is waiting for aggregation
+	n, err := s.RollupClicks(ctx, 1, clicks.Rollup)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, s.DeleteURL(ctx, "go"))
+	// clicks buffered before the delete are flushed after it
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{{Alias: "go", ClickedAt: bucket}}))
+
+	// another user takes the alias and sees no clicks of the deleted link
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "go", 2, 1, storage.SaveOptions{}))
+	n, err = s.RollupClicks(ctx, 10, clicks.Rollup)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	rollups, err := s.ListClickRollups(ctx, "go", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+	info, err := s.GetURLInfo(ctx, "go")
+	require.NoError(t, err)
+	assert.Zero(t, info.Clicks)
+}
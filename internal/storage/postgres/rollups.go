@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RollupClicks claims clicks with FOR UPDATE SKIP LOCKED, so aggregators
+// of different replicas take different clicks
+func (s *Storage) RollupClicks(ctx context.Context, limit int, fold func([]storage.SavedClick) []storage.ClickRollup) (int, error) {
+	const op = "storage.postgres.RollupClicks"
+
+	var claimed int
+	err := pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		stmt := `UPDATE clicks SET rolled_up = true
+			WHERE id IN (SELECT id FROM clicks WHERE NOT rolled_up ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED)
+			RETURNING id, alias, clicked_at, referrer, user_agent, ip_hash, request_id`
+		rows, err := tx.Query(ctx, stmt, limit)
+		if err != nil {
+			return err
+		}
+		var clicks []storage.SavedClick
+		for rows.Next() {
+			var c storage.SavedClick
+			err := rows.Scan(&c.ID, &c.Alias, &c.ClickedAt, &c.Referrer, &c.UserAgent, &c.IPHash, &c.RequestID)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			clicks = append(clicks, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		claimed = len(clicks)
+		if claimed == 0 {
+			return nil
+		}
+		return saveRollups(ctx, tx, fold(clicks))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return claimed, nil
+}
+
+// saveRollups adds rollups to stored ones. The rollup row is created first
+// and locked before its visitors are merged, so aggregators of different
+// replicas flushing the same bucket don't overwrite each other's sketches
+func saveRollups(ctx context.Context, tx pgx.Tx, rollups []storage.ClickRollup) error {
+	for _, r := range rollups {
+		_, err := tx.Exec(ctx, `INSERT INTO click_rollups (alias, bucket, clicks, visitors) VALUES($1, $2, 0, $3)
+				ON CONFLICT (alias, bucket) DO NOTHING`,
+			r.Alias, r.Bucket, []byte(hll.New()))
+		if err != nil {
+			return err
+		}
+		var stored []byte
+		stmt := `SELECT visitors FROM click_rollups WHERE alias = $1 AND bucket = $2 FOR UPDATE`
+		if err := tx.QueryRow(ctx, stmt, r.Alias, r.Bucket).Scan(&stored); err != nil {
+			return err
+		}
+		visitors, err := hll.MergeBytes(stored, r.Visitors)
+		if err != nil {
+			return err
+		}
+
+		batch := &pgx.Batch{}
+		batch.Queue(`UPDATE click_rollups SET clicks = clicks + $3, visitors = $4 WHERE alias = $1 AND bucket = $2`,
+			r.Alias, r.Bucket, r.Clicks, visitors)
+		for referrer, clicks := range r.Referrers {
+			batch.Queue(`INSERT INTO click_referrer_rollups (alias, bucket, referrer, clicks) VALUES($1, $2, $3, $4)
+					ON CONFLICT (alias, bucket, referrer) DO UPDATE
+					SET clicks = click_referrer_rollups.clicks + EXCLUDED.clicks`,
+				r.Alias, r.Bucket, referrer, clicks)
+		}
+		for family, clicks := range r.UserAgents {
+			batch.Queue(`INSERT INTO click_agent_rollups (alias, bucket, family, clicks) VALUES($1, $2, $3, $4)
+					ON CONFLICT (alias, bucket, family) DO UPDATE
+					SET clicks = click_agent_rollups.clicks + EXCLUDED.clicks`,
+				r.Alias, r.Bucket, family, clicks)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) ListClickRollups(ctx context.Context, alias string, from time.Time, to time.Time) ([]storage.ClickRollup, error) {
+	const op = "storage.postgres.ListClickRollups"
+
+	stmt := `SELECT bucket, clicks, visitors FROM click_rollups
+		WHERE alias = $1 AND bucket >= $2 AND bucket < $3 ORDER BY bucket`
+	rows, err := s.db.Query(ctx, stmt, alias, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var rollups []storage.ClickRollup
+	byBucket := make(map[time.Time]int)
+	for rows.Next() {
+		r := storage.ClickRollup{
+			Alias:      alias,
+			Referrers:  make(map[string]int64),
+			UserAgents: make(map[string]int64),
+		}
+		if err := rows.Scan(&r.Bucket, &r.Clicks, &r.Visitors); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.Bucket = r.Bucket.UTC()
+		byBucket[r.Bucket] = len(rollups)
+		rollups = append(rollups, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	details := []struct {
+		stmt string
+		get  func(r *storage.ClickRollup) map[string]int64
+	}{
+		{
+			stmt: `SELECT bucket, referrer, clicks FROM click_referrer_rollups
+				WHERE alias = $1 AND bucket >= $2 AND bucket < $3`,
+			get: func(r *storage.ClickRollup) map[string]int64 { return r.Referrers },
+		},
+		{
+			stmt: `SELECT bucket, family, clicks FROM click_agent_rollups
+				WHERE alias = $1 AND bucket >= $2 AND bucket < $3`,
+			get: func(r *storage.ClickRollup) map[string]int64 { return r.UserAgents },
+		},
+	}
+	for _, d := range details {
+		rows, err := s.db.Query(ctx, d.stmt, alias, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		for rows.Next() {
+			var (
+				bucket time.Time
+				name   string
+				clicks int64
+			)
+			if err := rows.Scan(&bucket, &name, &clicks); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			if i, ok := byBucket[bucket.UTC()]; ok {
+				d.get(&rollups[i])[name] = clicks
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return rollups, nil
+}
@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"time"
+)
+
+// RollupClicks claims clicks in a write transaction, sqlite has one writer
+// so concurrent calls never take the same clicks
+func (s *Storage) RollupClicks(ctx context.Context, limit int, fold func([]storage.SavedClick) []storage.ClickRollup) (int, error) {
+	const op = "storage.sqlite.RollupClicks"
+
+	var claimed int
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := `UPDATE clicks SET rolled_up = 1
+			WHERE id IN (SELECT id FROM clicks WHERE rolled_up = 0 ORDER BY id LIMIT ?)
+			RETURNING id, alias, clicked_at, referrer, user_agent, ip_hash, request_id`
+		rows, err := tx.QueryContext(ctx, stmt, limit)
+		if err != nil {
+			return err
+		}
+		var clicks []storage.SavedClick
+		for rows.Next() {
+			var c storage.SavedClick
+			err := rows.Scan(&c.ID, &c.Alias, &c.ClickedAt, &c.Referrer, &c.UserAgent, &c.IPHash, &c.RequestID)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			clicks = append(clicks, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		claimed = len(clicks)
+		if claimed == 0 {
+			return nil
+		}
+		return saveRollups(ctx, tx, fold(clicks))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return claimed, nil
+}
+
+// saveRollups adds rollups to stored ones
+func saveRollups(ctx context.Context, tx *sql.Tx, rollups []storage.ClickRollup) error {
+	for _, r := range rollups {
+		bucket := r.Bucket.UTC()
+
+		var stored []byte
+		stmt := `SELECT visitors FROM click_rollups WHERE alias = ? AND bucket = ?`
+		err := tx.QueryRowContext(ctx, stmt, r.Alias, bucket).Scan(&stored)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		visitors, err := hll.MergeBytes(stored, r.Visitors)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO click_rollups (alias, bucket, clicks, visitors) VALUES(?, ?, ?, ?)
+				ON CONFLICT (alias, bucket) DO UPDATE
+				SET clicks = clicks + excluded.clicks, visitors = excluded.visitors`,
+			r.Alias, bucket, r.Clicks, visitors)
+		if err != nil {
+			return err
+		}
+		for referrer, clicks := range r.Referrers {
+			_, err := tx.ExecContext(ctx, `INSERT INTO click_referrer_rollups (alias, bucket, referrer, clicks) VALUES(?, ?, ?, ?)
+					ON CONFLICT (alias, bucket, referrer) DO UPDATE SET clicks = clicks + excluded.clicks`,
+				r.Alias, bucket, referrer, clicks)
+			if err != nil {
+				return err
+			}
+		}
+		for family, clicks := range r.UserAgents {
+			_, err := tx.ExecContext(ctx, `INSERT INTO click_agent_rollups (alias, bucket, family, clicks) VALUES(?, ?, ?, ?)
+					ON CONFLICT (alias, bucket, family) DO UPDATE SET clicks = clicks + excluded.clicks`,
+				r.Alias, bucket, family, clicks)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Storage) ListClickRollups(ctx context.Context, alias string, from time.Time, to time.Time) ([]storage.ClickRollup, error) {
+	const op = "storage.sqlite.ListClickRollups"
+
+	from, to = from.UTC(), to.UTC()
+
+	stmt := `SELECT bucket, clicks, visitors FROM click_rollups
+		WHERE alias = ? AND bucket >= ? AND bucket < ? ORDER BY bucket`
+	rows, err := s.db.QueryContext(ctx, stmt, alias, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var rollups []storage.ClickRollup
+	byBucket := make(map[time.Time]int)
+	for rows.Next() {
+		r := storage.ClickRollup{
+			Alias:      alias,
+			Referrers:  make(map[string]int64),
+			UserAgents: make(map[string]int64),
+		}
+		if err := rows.Scan(&r.Bucket, &r.Clicks, &r.Visitors); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.Bucket = r.Bucket.UTC()
+		byBucket[r.Bucket] = len(rollups)
+		rollups = append(rollups, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	details := []struct {
+		stmt string
+		get  func(r *storage.ClickRollup) map[string]int64
+	}{
+		{
+			stmt: `SELECT bucket, referrer, clicks FROM click_referrer_rollups
+				WHERE alias = ? AND bucket >= ? AND bucket < ?`,
+			get: func(r *storage.ClickRollup) map[string]int64 { return r.Referrers },
+		},
+		{
+			stmt: `SELECT bucket, family, clicks FROM click_agent_rollups
+				WHERE alias = ? AND bucket >= ? AND bucket < ?`,
+			get: func(r *storage.ClickRollup) map[string]int64 { return r.UserAgents },
+		},
+	}
+	for _, d := range details {
+		rows, err := s.db.QueryContext(ctx, d.stmt, alias, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		for rows.Next() {
+			var (
+				bucket time.Time
+				name   string
+				clicks int64
+			)
+			if err := rows.Scan(&bucket, &name, &clicks); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			if i, ok := byBucket[bucket.UTC()]; ok {
+				d.get(&rollups[i])[name] = clicks
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return rollups, nil
+}
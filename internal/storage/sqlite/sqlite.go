@@ -0,0 +1,543 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/neepooha/url_shortener/internal/config"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type Storage struct {
+	db *sql.DB
+}
+
+func NewStorage(cfg *config.Config) (*Storage, error) {
+	const op = "storage.sqlite.NewStorage"
+
+	// busy_timeout makes concurrent writers wait for the lock instead of failing with SQLITE_BUSY
+	// _time_format=sqlite stores times as sortable text,
+	// _txlock=immediate takes the write lock when a transaction begins to avoid deadlocks on upgrade
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"+
+		"&_time_format=sqlite&_txlock=immediate", cfg.Storage.Path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &Storage{db: db}, nil
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Storage) CloseStorage() {
+	s.db.Close()
+}
+
+func (s *Storage) SaveURL(ctx context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts storage.SaveOptions) error {
+	const op = "storage.sqlite.SaveURL"
+
+	err := insertURL(ctx, s.db, storage.NewURL{URL: urlToSave, Alias: alias, OwnerUID: ownerUID, AppID: appID, Opts: opts})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) SaveURLs(ctx context.Context, urls []storage.NewURL) error {
+	const op = "storage.sqlite.SaveURLs"
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for i, u := range urls {
+			if err := insertURL(ctx, tx, u); err != nil {
+				return &storage.BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// execer is db or transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertURL(ctx context.Context, db execer, u storage.NewURL) error {
+	stmt := `INSERT INTO urls (id, url, alias, owner_uid, app_id, host, created_at, updated_at, expires_at, max_clicks)
+		VALUES(NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0))`
+	createdAt := now()
+	if !u.Opts.CreatedAt.IsZero() {
+		createdAt = u.Opts.CreatedAt.UTC().Truncate(time.Microsecond)
+	}
+	var expiresAt any
+	if u.Opts.ExpiresAt != nil {
+		expiresAt = u.Opts.ExpiresAt.UTC().Truncate(time.Microsecond)
+	}
+	_, err := db.ExecContext(ctx, stmt, u.Opts.ID, u.URL, u.Alias, int64(u.OwnerUID), u.AppID, storage.URLHost(u.URL),
+		createdAt, createdAt, expiresAt, u.Opts.MaxClicks)
+	if err != nil {
+		if IsDuplicatedKeyError(err) {
+			return storage.ErrURLExists
+		}
+		return err
+	}
+	return nil
+}
+
+// NextURLID moves AUTOINCREMENT counter of urls,
+// so the reserved id is never assigned to another row
+func (s *Storage) NextURLID(ctx context.Context) (int64, error) {
+	const op = "storage.sqlite.NextURLID"
+
+	var id int64
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO sqlite_sequence (name, seq)
+			SELECT 'urls', COALESCE((SELECT MAX(id) FROM urls), 0)
+			WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'urls')`)
+		if err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, `UPDATE sqlite_sequence SET seq = seq + 1 WHERE name = 'urls' RETURNING seq`).Scan(&id)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Storage) GetURL(ctx context.Context, alias string) (string, error) {
+	const op = "storage.sqlite.GetURL"
+
+	stmt := `SELECT url FROM urls WHERE alias = ?`
+	var resURL string
+	err := s.db.QueryRowContext(ctx, stmt, alias).Scan(&resURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return resURL, nil
+}
+
+// GetURLOwner returns uid of the user who created the link.
+// Links created before ownership was recorded have owner 0.
+func (s *Storage) GetURLOwner(ctx context.Context, alias string) (uint64, error) {
+	const op = "storage.sqlite.GetURLOwner"
+
+	stmt := `SELECT COALESCE(owner_uid, 0) FROM urls WHERE alias = ?`
+	var ownerUID int64
+	err := s.db.QueryRowContext(ctx, stmt, alias).Scan(&ownerUID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAliasNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uint64(ownerUID), nil
+}
+
+// GetURLInfo returns the whole link row
+func (s *Storage) GetURLInfo(ctx context.Context, alias string) (storage.URL, error) {
+	const op = "storage.sqlite.GetURLInfo"
+
+	stmt := `SELECT ` + urlColumns + ` FROM urls WHERE alias = ?`
+	u, err := scanURL(s.db.QueryRowContext(ctx, stmt, alias))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.URL{}, fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+		}
+		return storage.URL{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return u, nil
+}
+
+// ListURLs returns one page of links using keyset pagination over (created_at, id)
+func (s *Storage) ListURLs(ctx context.Context, filter storage.ListFilter) ([]storage.URL, error) {
+	const op = "storage.sqlite.ListURLs"
+
+	var (
+		conds []string
+		args  []any
+	)
+	if filter.OwnerUID != nil {
+		conds = append(conds, "owner_uid = ?")
+		args = append(args, int64(*filter.OwnerUID))
+	}
+	if filter.AliasPrefix != "" {
+		// LIKE is case insensitive in sqlite, aliases are not
+		conds = append(conds, "substr(alias, 1, ?) = ?")
+		args = append(args, len([]rune(filter.AliasPrefix)), filter.AliasPrefix)
+	}
+	if filter.Host != "" {
+		conds = append(conds, "host = ?")
+		args = append(args, strings.ToLower(filter.Host))
+	}
+	order, cmp := "DESC", "<"
+	if filter.Asc {
+		order, cmp = "ASC", ">"
+	}
+	if filter.After != nil {
+		conds = append(conds, fmt.Sprintf("(created_at, id) %s (?, ?)", cmp))
+		args = append(args, filter.After.CreatedAt.UTC(), filter.After.ID)
+	}
+
+	stmt := `SELECT ` + urlColumns + ` FROM urls`
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+	stmt += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT ?", order, order)
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var urls []storage.URL
+	for rows.Next() {
+		u, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		urls = append(urls, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return urls, nil
+}
+
+// UpdateURL changes destination of the link and keeps the previous one in url_revisions
+func (s *Storage) UpdateURL(ctx context.Context, alias string, newURL string, changedBy uint64) error {
+	const op = "storage.sqlite.UpdateURL"
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		return replaceURL(ctx, tx, alias, newURL, changedBy)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ListURLRevisions returns previous destinations of the link, newest first
+func (s *Storage) ListURLRevisions(ctx context.Context, alias string) ([]storage.Revision, error) {
+	const op = "storage.sqlite.ListURLRevisions"
+
+	stmt := `SELECT r.id, r.url, r.changed_by, r.changed_at FROM url_revisions r
+		JOIN urls u ON u.id = r.url_id WHERE u.alias = ? ORDER BY r.id DESC`
+	rows, err := s.db.QueryContext(ctx, stmt, alias)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var revisions []storage.Revision
+	for rows.Next() {
+		var (
+			rev       storage.Revision
+			changedBy int64
+		)
+		if err := rows.Scan(&rev.ID, &rev.URL, &changedBy, &rev.ChangedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		rev.ChangedBy = uint64(changedBy)
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return revisions, nil
+}
+
+// RollbackURL restores destination from the revision and returns it.
+// The replaced destination becomes a new revision, so rollback can be undone.
+func (s *Storage) RollbackURL(ctx context.Context, alias string, revisionID int64, changedBy uint64) (string, error) {
+	const op = "storage.sqlite.RollbackURL"
+
+	var restored string
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := `SELECT r.url FROM url_revisions r
+			JOIN urls u ON u.id = r.url_id WHERE u.alias = ? AND r.id = ?`
+		err := tx.QueryRowContext(ctx, stmt, alias, revisionID).Scan(&restored)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return storage.ErrRevisionNotFound
+			}
+			return err
+		}
+		return replaceURL(ctx, tx, alias, restored, changedBy)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return restored, nil
+}
+
+func replaceURL(ctx context.Context, tx *sql.Tx, alias string, newURL string, changedBy uint64) error {
+	var (
+		id     int64
+		oldURL string
+	)
+	err := tx.QueryRowContext(ctx, `SELECT id, url FROM urls WHERE alias = ?`, alias).Scan(&id, &oldURL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrURLNotFound
+		}
+		return err
+	}
+
+	changedAt := now()
+	stmt := `INSERT INTO url_revisions (url_id, url, changed_by, changed_at) VALUES(?, ?, ?, ?)`
+	if _, err := tx.ExecContext(ctx, stmt, id, oldURL, int64(changedBy), changedAt); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE urls SET url = ?, host = ?, updated_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, stmt, newURL, storage.URLHost(newURL), changedAt, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction and commits it if fn succeeds
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteURL removes the link with its clicks and stats
+func (s *Storage) DeleteURL(ctx context.Context, alias string) error {
+	const op = "storage.sqlite.DeleteURL"
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := `DELETE FROM urls WHERE alias = ?`
+		res, err := tx.ExecContext(ctx, stmt, alias)
+		if err != nil {
+			return err
+		}
+		affect, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affect == 0 {
+			return storage.ErrAliasNotFound
+		}
+		return deleteClicks(ctx, tx, `alias = ?`, alias)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// deleteClicks removes clicks and rollups of deleted links matching where,
+// so a link saved later with the same alias starts without stats
+func deleteClicks(ctx context.Context, tx *sql.Tx, where string, args ...any) error {
+	for _, table := range []string{"clicks", "click_rollups", "click_referrer_rollups", "click_agent_rollups"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+where, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConsumeClick counts a redirect against max_clicks of the link.
+// It returns storage.ErrURLExhausted if no clicks are left.
+func (s *Storage) ConsumeClick(ctx context.Context, alias string) error {
+	const op = "storage.sqlite.ConsumeClick"
+
+	// the last click starts grace of the link before purge
+	stmt := `UPDATE urls SET used_clicks = used_clicks + 1,
+			exhausted_at = CASE WHEN used_clicks + 1 >= max_clicks THEN ? ELSE exhausted_at END
+		WHERE alias = ? AND (max_clicks IS NULL OR used_clicks < max_clicks)`
+	res, err := s.db.ExecContext(ctx, stmt, now(), alias)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	affect, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affect == 0 {
+		_, err := s.GetURLOwner(ctx, alias)
+		if errors.Is(err, storage.ErrAliasNotFound) {
+			return fmt.Errorf("%s: %w", op, storage.ErrURLNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %w", op, storage.ErrURLExhausted)
+	}
+	return nil
+}
+
+// DeleteExpiredURLs removes links expired or exhausted before cutoff with their clicks and stats.
+// With archive they are moved to urls_archive.
+func (s *Storage) DeleteExpiredURLs(ctx context.Context, cutoff time.Time, archive bool) (int64, error) {
+	const op = "storage.sqlite.DeleteExpiredURLs"
+
+	const expired = `expires_at < ? OR exhausted_at < ?`
+	var deleted int64
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if archive {
+			stmt := `INSERT INTO urls_archive
+				(id, alias, url, owner_uid, app_id, created_at, expires_at, max_clicks, used_clicks, clicks, archived_at)
+				SELECT id, alias, url, owner_uid, app_id, created_at, expires_at, max_clicks, used_clicks, clicks, ?
+				FROM urls WHERE ` + expired
+			if _, err := tx.ExecContext(ctx, stmt, now(), cutoff.UTC(), cutoff.UTC()); err != nil {
+				return err
+			}
+		}
+		err := deleteClicks(ctx, tx, `alias IN (SELECT alias FROM urls WHERE `+expired+`)`, cutoff.UTC(), cutoff.UTC())
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE `+expired, cutoff.UTC(), cutoff.UTC())
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return deleted, nil
+}
+
+// SaveClicks inserts clicks in one transaction and adds them to urls.clicks totals.
+// Clicks of links deleted meanwhile are dropped, they would be stats of the next link with the alias.
+func (s *Storage) SaveClicks(ctx context.Context, clicks []storage.Click) error {
+	const op = "storage.sqlite.SaveClicks"
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		live, err := liveAliases(ctx, tx, clicks)
+		if err != nil {
+			return err
+		}
+
+		insert, err := tx.PrepareContext(ctx, `INSERT INTO clicks
+			(alias, clicked_at, referrer, user_agent, ip_hash, request_id) VALUES(?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+
+		counts := make(map[string]int64)
+		for _, c := range clicks {
+			if !live[c.Alias] {
+				continue
+			}
+			_, err := insert.ExecContext(ctx, c.Alias, c.ClickedAt.UTC(), c.Referrer, c.UserAgent, c.IPHash, c.RequestID)
+			if err != nil {
+				return err
+			}
+			counts[c.Alias]++
+		}
+		for alias, count := range counts {
+			_, err := tx.ExecContext(ctx, `UPDATE urls SET clicks = clicks + ? WHERE alias = ?`, count, alias)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// liveAliases returns which aliases of clicks have links
+func liveAliases(ctx context.Context, tx *sql.Tx, clicks []storage.Click) (map[string]bool, error) {
+	live := make(map[string]bool)
+	var (
+		args         []any
+		placeholders []string
+	)
+	for _, c := range clicks {
+		if _, ok := live[c.Alias]; ok {
+			continue
+		}
+		live[c.Alias] = false
+		args = append(args, c.Alias)
+		placeholders = append(placeholders, "?")
+	}
+	if len(args) == 0 {
+		return live, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT alias FROM urls WHERE alias IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		live[alias] = true
+	}
+	return live, rows.Err()
+}
+
+// urlColumns are columns read by scanURL
+const urlColumns = `id, alias, url, host, COALESCE(owner_uid, 0), COALESCE(app_id, 0),
+	created_at, updated_at, redirect_type, clicks, expires_at, COALESCE(max_clicks, 0), used_clicks`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row scanner) (storage.URL, error) {
+	var (
+		u        storage.URL
+		ownerUID int64
+	)
+	err := row.Scan(&u.ID, &u.Alias, &u.URL, &u.Host, &ownerUID, &u.AppID,
+		&u.CreatedAt, &u.UpdatedAt, &u.RedirectType, &u.Clicks, &u.ExpiresAt, &u.MaxClicks, &u.UsedClicks)
+	u.OwnerUID = uint64(ownerUID)
+	return u, err
+}
+
+// now returns current time in the form it is stored in sqlite
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func IsDuplicatedKeyError(err error) bool {
+	var serr *sqlite.Error
+	if errors.As(err, &serr) {
+		return serr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || serr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/clicks"
+	"github.com/neepooha/url_shortener/internal/config"
+	"github.com/neepooha/url_shortener/internal/lib/hll"
+	"github.com/neepooha/url_shortener/internal/lib/migrator"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+
+	cfg := &config.Config{Storage: config.Storage{
+		Driver:          storage.DriverSQLite,
+		Path:            filepath.Join(t.TempDir(), "url.db"),
+		Migrations_path: "../../../migrations/sqlite",
+	}}
+	require.NoError(t, migrator.Migrate(cfg))
+
+	s, err := NewStorage(cfg)
+	require.NoError(t, err)
+	t.Cleanup(s.CloseStorage)
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	// seeded by migrations
+	resURL, err := s.GetURL(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, "https://habr.com/", resURL)
+
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "go", 1, 1, storage.SaveOptions{}))
+	assert.ErrorIs(t, s.SaveURL(ctx, "https://go.dev/doc/", "go", 1, 1, storage.SaveOptions{}), storage.ErrURLExists)
+
+	ownerUID, err := s.GetURLOwner(ctx, "go")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), ownerUID)
+
+	info, err := s.GetURLInfo(ctx, "go")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/", info.URL)
+	assert.Equal(t, "go.dev", info.Host)
+	assert.Equal(t, storage.DefaultRedirectType, info.RedirectType)
+	assert.False(t, info.CreatedAt.IsZero())
+	assert.Equal(t, info.CreatedAt, info.UpdatedAt)
+
+	// seeded links have no owner
+	ownerUID, err = s.GetURLOwner(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), ownerUID)
+
+	_, err = s.GetURL(ctx, "unknown")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+
+	require.NoError(t, s.DeleteURL(ctx, "go"))
+	assert.ErrorIs(t, s.DeleteURL(ctx, "go"), storage.ErrAliasNotFound)
+}
+
+func TestListURLs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "go1", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveURL(ctx, "https://GO.dev/blog/", "go2", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveURL(ctx, "https://habr.com/ru/", "Go3", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/play/", "go4", 2, 1, storage.SaveOptions{}))
+
+	owner := uint64(1)
+
+	// newest first, two per page
+	page, err := s.ListURLs(ctx, storage.ListFilter{OwnerUID: &owner, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "Go3", page[0].Alias)
+	assert.Equal(t, "go2", page[1].Alias)
+
+	last := page[1]
+	page, err = s.ListURLs(ctx, storage.ListFilter{
+		OwnerUID: &owner,
+		After:    &storage.Cursor{CreatedAt: last.CreatedAt, ID: last.ID},
+		Limit:    2,
+	})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "go1", page[0].Alias)
+
+	// prefix is case sensitive, host is not
+	page, err = s.ListURLs(ctx, storage.ListFilter{AliasPrefix: "go", Host: "Go.Dev", Asc: true, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page, 3)
+	assert.Equal(t, "go1", page[0].Alias)
+	assert.Equal(t, "go4", page[2].Alias)
+}
+
+func TestURLRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/v1", "go", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.UpdateURL(ctx, "go", "https://go.dev/v2", 1))
+	require.NoError(t, s.UpdateURL(ctx, "go", "https://go.dev/v3", 2))
+	assert.ErrorIs(t, s.UpdateURL(ctx, "unknown", "https://go.dev/", 1), storage.ErrURLNotFound)
+
+	revisions, err := s.ListURLRevisions(ctx, "go")
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, "https://go.dev/v2", revisions[0].URL)
+	assert.Equal(t, uint64(2), revisions[0].ChangedBy)
+	assert.Equal(t, "https://go.dev/v1", revisions[1].URL)
+
+	restored, err := s.RollbackURL(ctx, "go", revisions[1].ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/v1", restored)
+
+	resURL, err := s.GetURL(ctx, "go")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/v1", resURL)
+
+	_, err = s.RollbackURL(ctx, "habr", revisions[1].ID, 1)
+	assert.ErrorIs(t, err, storage.ErrRevisionNotFound)
+
+	// revisions are removed with the link
+	require.NoError(t, s.DeleteURL(ctx, "go"))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "go", 1, 1, storage.SaveOptions{}))
+	revisions, err = s.ListURLRevisions(ctx, "go")
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+}
+
+func TestSaveClicks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	now := time.Now()
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{
+		{Alias: "habr", ClickedAt: now, Referrer: "https://t.me/", IPHash: "a"},
+		{Alias: "habr", ClickedAt: now, IPHash: "b"},
+		{Alias: "deleted", ClickedAt: now},
+	}))
+
+	info, err := s.GetURLInfo(ctx, "habr")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), info.Clicks)
+}
+
+func TestClickRollups(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	bucket := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{
+		{Alias: "habr", ClickedAt: bucket.Add(time.Minute)},
+		{Alias: "habr", ClickedAt: bucket.Add(2 * time.Minute)},
+	}))
+
+	visitors := hll.New()
+	visitors.Add("a")
+	var claimed []int64
+	fold := func(clicks []storage.SavedClick) []storage.ClickRollup {
+		for _, c := range clicks {
+			claimed = append(claimed, c.ID)
+		}
+		return []storage.ClickRollup{{
+			Alias:      "habr",
+			Bucket:     bucket,
+			Clicks:     int64(len(clicks)),
+			Referrers:  map[string]int64{"direct": int64(len(clicks))},
+			UserAgents: map[string]int64{"Chrome": int64(len(clicks))},
+			Visitors:   visitors,
+		}}
+	}
+
+	n, err := s.RollupClicks(ctx, 10, fold)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	// claimed clicks aren't rolled up twice
+	n, err = s.RollupClicks(ctx, 10, fold)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// a replica commits a click with a lower id after higher ids are rolled up
+	_, err = s.db.ExecContext(ctx, `INSERT INTO clicks (id, alias, clicked_at) VALUES (100, 'habr', ?)`, bucket.Add(3*time.Minute))
+	require.NoError(t, err)
+	n, err = s.RollupClicks(ctx, 10, fold)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = s.db.ExecContext(ctx, `INSERT INTO clicks (id, alias, clicked_at) VALUES (50, 'habr', ?)`, bucket.Add(4*time.Minute))
+	require.NoError(t, err)
+	n, err = s.RollupClicks(ctx, 10, fold)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []int64{1, 2, 100, 50}, claimed)
+
+	rollups, err := s.ListClickRollups(ctx, "habr", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 1)
+	assert.True(t, rollups[0].Bucket.Equal(bucket))
+	assert.Equal(t, int64(4), rollups[0].Clicks)
+	assert.Equal(t, map[string]int64{"direct": 4}, rollups[0].Referrers)
+	assert.Equal(t, map[string]int64{"Chrome": 4}, rollups[0].UserAgents)
+
+	sketch, err := hll.FromBytes(rollups[0].Visitors)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), sketch.Estimate())
+
+	rollups, err = s.ListClickRollups(ctx, "habr", bucket.Add(time.Hour), bucket.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "dated", 1, 1, storage.SaveOptions{ExpiresAt: &expiresAt}))
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "limited", 1, 1, storage.SaveOptions{MaxClicks: 1}))
+
+	info, err := s.GetURLInfo(ctx, "dated")
+	require.NoError(t, err)
+	require.NotNil(t, info.ExpiresAt)
+	assert.True(t, info.ExpiresAt.Equal(expiresAt.Truncate(time.Microsecond)))
+	assert.False(t, info.Expired(time.Now()))
+
+	// clicks are counted only up to the limit
+	require.NoError(t, s.ConsumeClick(ctx, "limited"))
+	assert.ErrorIs(t, s.ConsumeClick(ctx, "limited"), storage.ErrURLExhausted)
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{{Alias: "limited", ClickedAt: bucket}}))
+	_, err = s.RollupClicks(ctx, 10, clicks.Rollup)
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.ConsumeClick(ctx, "unknown"), storage.ErrURLNotFound)
+	require.NoError(t, s.ConsumeClick(ctx, "habr"))
+
+	// exhausted link is kept for grace like an expired one
+	deleted, err := s.DeleteExpiredURLs(ctx, time.Now().Add(-time.Minute), true)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	_, err = s.GetURL(ctx, "limited")
+	assert.NoError(t, err)
+
+	// then it is swept, dated one after its expiration
+	deleted, err = s.DeleteExpiredURLs(ctx, time.Now().Add(time.Second), true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = s.GetURL(ctx, "limited")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+	// the alias is reissued without stats of the purged link
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "limited", 2, 1, storage.SaveOptions{}))
+	rollups, err := s.ListClickRollups(ctx, "limited", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+
+	deleted, err = s.DeleteExpiredURLs(ctx, expiresAt.Add(time.Second), false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = s.GetURL(ctx, "habr")
+	assert.NoError(t, err)
+
+	var archived int
+	require.NoError(t, s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM urls_archive`).Scan(&archived))
+	assert.Equal(t, 1, archived)
+}
+
+func TestNextURLID(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	id, err := s.NextURLID(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "reserved", 1, 1, storage.SaveOptions{ID: id}))
+	info, err := s.GetURLInfo(ctx, "reserved")
+	require.NoError(t, err)
+	assert.Equal(t, id, info.ID)
+
+	// reserved ids are not assigned to rows saved without id
+	next, err := s.NextURLID(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "auto", 1, 1, storage.SaveOptions{}))
+	info, err = s.GetURLInfo(ctx, "auto")
+	require.NoError(t, err)
+	assert.Greater(t, info.ID, next)
+
+	err = s.SaveURL(ctx, "https://go.dev/", "other", 1, 1, storage.SaveOptions{ID: id})
+	assert.ErrorIs(t, err, storage.ErrURLExists)
+}
+
+func TestSaveURLs(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	require.NoError(t, s.SaveURLs(ctx, []storage.NewURL{
+		{URL: "https://go.dev/", Alias: "go1", OwnerUID: 1, AppID: 1},
+		{URL: "https://go.dev/doc/", Alias: "go2", OwnerUID: 1, AppID: 1},
+	}))
+
+	// conflict rolls back the whole batch
+	err := s.SaveURLs(ctx, []storage.NewURL{
+		{URL: "https://go.dev/blog/", Alias: "go3", OwnerUID: 1, AppID: 1},
+		{URL: "https://habr.com/", Alias: "habr", OwnerUID: 1, AppID: 1},
+	})
+	var batchErr *storage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.ErrorIs(t, err, storage.ErrURLExists)
+
+	_, err = s.GetURL(ctx, "go3")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+	resURL, err := s.GetURL(ctx, "go2")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/doc/", resURL)
+}
+
+func TestDeleteURLClicks(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	bucket := time.Now().UTC().Truncate(time.Hour)
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/", "go", 1, 1, storage.SaveOptions{}))
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{
+		{Alias: "go", ClickedAt: bucket, IPHash: "a"},
+		{Alias: "go", ClickedAt: bucket, IPHash: "b"},
+	}))
+	// one click is in stats, the other is waiting for aggregation
+	n, err := s.RollupClicks(ctx, 1, clicks.Rollup)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, s.DeleteURL(ctx, "go"))
+	// clicks buffered before the delete are flushed after it
+	require.NoError(t, s.SaveClicks(ctx, []storage.Click{{Alias: "go", ClickedAt: bucket}}))
+
+	// another user takes the alias and sees no clicks of the deleted link
+	require.NoError(t, s.SaveURL(ctx, "https://go.dev/doc/", "go", 2, 1, storage.SaveOptions{}))
+	n, err = s.RollupClicks(ctx, 10, clicks.Rollup)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	rollups, err := s.ListClickRollups(ctx, "go", bucket, bucket.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, rollups)
+	info, err := s.GetURLInfo(ctx, "go")
+	require.NoError(t, err)
+	assert.Zero(t, info.Clicks)
+}
@@ -1,9 +1,185 @@
 package storage
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
 
+// errors returned by every storage driver, check them with errors.Is
 var (
-	ErrURLNotFound   = errors.New("url not found")
-	ErrURLExists     = errors.New("url exists")
-	ErrAliasNotFound = errors.New("alias not found")
+	ErrURLNotFound = errors.New("url not found")
+	ErrURLExists   = errors.New("url exists")
+	// ErrAliasNotFound is ErrURLNotFound too
+	ErrAliasNotFound = fmt.Errorf("alias not found: %w", ErrURLNotFound)
+
+	ErrURLExpired   = errors.New("url expired")
+	ErrURLExhausted = errors.New("url clicks limit is reached")
+
+	ErrRevisionNotFound = errors.New("revision not found")
 )
+
+// names of storage drivers for config.Storage.Driver
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+	DriverSQLite   = "sqlite"
+)
+
+// URLStorage is the contract every storage driver implements
+type URLStorage interface {
+	SaveURL(ctx context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts SaveOptions) error
+	// SaveURLs saves all links in one transaction or none of them, see BatchError
+	SaveURLs(ctx context.Context, urls []NewURL) error
+	// NextURLID reserves id for SaveOptions.ID, reserved ids are never returned again
+	NextURLID(ctx context.Context) (int64, error)
+	GetURL(ctx context.Context, alias string) (string, error)
+	GetURLOwner(ctx context.Context, alias string) (uint64, error)
+	GetURLInfo(ctx context.Context, alias string) (URL, error)
+	ListURLs(ctx context.Context, filter ListFilter) ([]URL, error)
+	UpdateURL(ctx context.Context, alias string, newURL string, changedBy uint64) error
+	ListURLRevisions(ctx context.Context, alias string) ([]Revision, error)
+	RollbackURL(ctx context.Context, alias string, revisionID int64, changedBy uint64) (string, error)
+	DeleteURL(ctx context.Context, alias string) error
+	ConsumeClick(ctx context.Context, alias string) error
+	DeleteExpiredURLs(ctx context.Context, cutoff time.Time, archive bool) (int64, error)
+	SaveClicks(ctx context.Context, clicks []Click) error
+	ClickRollupStorage
+	CloseStorage()
+}
+
+// URL is a stored link
+type URL struct {
+	ID           int64
+	Alias        string
+	URL          string
+	Host         string
+	OwnerUID     uint64
+	AppID        int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	RedirectType int
+	Clicks       int64
+	ExpiresAt    *time.Time // nil means link never expires
+	MaxClicks    int64      // 0 means no limit
+	UsedClicks   int64      // redirects counted against MaxClicks
+}
+
+// Expired reports whether the link is dead by date or by clicks at now
+func (u URL) Expired(now time.Time) bool {
+	if u.ExpiresAt != nil && !now.Before(*u.ExpiresAt) {
+		return true
+	}
+	return u.MaxClicks > 0 && u.UsedClicks >= u.MaxClicks
+}
+
+// SaveOptions are optional properties of a new link
+type SaveOptions struct {
+	ID        int64 // reserved by NextURLID, 0 means next id of the sequence
+	ExpiresAt *time.Time
+	MaxClicks int64
+	CreatedAt time.Time // zero means now, set by imports
+}
+
+// NewURL is a link saved by SaveURLs
+type NewURL struct {
+	URL      string
+	Alias    string
+	OwnerUID uint64
+	AppID    int
+	Opts     SaveOptions
+}
+
+// BatchError tells which link made SaveURLs fail, nothing is saved then
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("link %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultRedirectType is http status code used to redirect by alias
+const DefaultRedirectType = 302
+
+// Revision is a previous destination of a link.
+// ChangedBy is uid of the user who replaced it at ChangedAt.
+type Revision struct {
+	ID        int64
+	URL       string
+	ChangedBy uint64
+	ChangedAt time.Time
+}
+
+// Click is one redirect by alias
+type Click struct {
+	Alias     string
+	ClickedAt time.Time
+	Referrer  string
+	UserAgent string
+	IPHash    string
+	RequestID string
+}
+
+// SavedClick is a click with its id, ids grow with every saved click
+type SavedClick struct {
+	ID int64
+	Click
+}
+
+// ClickRollup is an aggregate of clicks by alias for one hour starting at Bucket
+type ClickRollup struct {
+	Alias      string
+	Bucket     time.Time
+	Clicks     int64
+	Referrers  map[string]int64
+	UserAgents map[string]int64
+	Visitors   []byte // hll.Sketch of ip hashes
+}
+
+// ClickRollupStorage keeps hourly rollups of clicks.
+// Every click is marked when it is rolled up, so clicks committed late
+// by other replicas are still counted.
+type ClickRollupStorage interface {
+	// RollupClicks claims up to limit clicks which aren't rolled up yet and adds rollups
+	// built of them by fold in the same transaction. It returns the number of claimed clicks.
+	// Clicks claimed by a concurrent call are skipped.
+	RollupClicks(ctx context.Context, limit int, fold func([]SavedClick) []ClickRollup) (int, error)
+	// ListClickRollups returns rollups of alias with bucket in [from, to), ordered by bucket
+	ListClickRollups(ctx context.Context, alias string, from time.Time, to time.Time) ([]ClickRollup, error)
+}
+
+// Cursor points at the last link of the previous page
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// ListFilter describes which links ListURLs returns.
+// Links are ordered by creation time, newest first unless Asc is set.
+type ListFilter struct {
+	OwnerUID    *uint64 // nil means links of all users
+	AliasPrefix string
+	Host        string
+	After       *Cursor
+	Asc         bool
+	Limit       int
+}
+
+// URLHost returns lowercased host of the url without port,
+// it is stored next to the url to filter links by destination
+func URLHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
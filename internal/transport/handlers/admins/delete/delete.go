@@ -3,13 +3,14 @@ package delete
 import (
 	"context"
 	"errors"
+	"github.com/neepooha/url_shortener/internal/clients/sso"
 	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
 	"log/slog"
 	"net/http"
-	"strings"
 
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"google.golang.org/grpc/metadata"
 )
@@ -27,28 +28,6 @@ type PermissionDeleter interface {
 	DelAdmin(ctx context.Context, email string, appid int) (bool, error)
 }
 
-func exractToken(header http.Header) (string, error) {
-	if len(header) == 0 {
-		return "", errors.New("no headers in request")
-	}
-	authHeaders, ok := header["Authorization"]
-	if !ok {
-		return "", errors.New("no Authorization in header")
-	}
-	if len(authHeaders) != 1 {
-		return "", errors.New("more than 1 header in request")
-	}
-	auth := authHeaders[0]
-	const prefix = "Bearer "
-	if !strings.HasPrefix(auth, prefix) {
-		return "", errors.New(`missing "Bearer " prefix in "Authorization" header`)
-	}
-	if auth[len(prefix):] == "" {
-		return "", errors.New(`missing token in "Authorization" header`)
-	}
-	return auth, nil
-}
-
 func New(log *slog.Logger, permProvider PermissionDeleter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.url.delete.New"
@@ -57,6 +36,7 @@ func New(log *slog.Logger, permProvider PermissionDeleter) http.HandlerFunc {
 		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
 		// decode json request
@@ -64,29 +44,18 @@ func New(log *slog.Logger, permProvider PermissionDeleter) http.HandlerFunc {
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to decode request"))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "failed to decode request")
 			return
 		}
 		log.Info("request body decoded", slog.Any("request", req))
 
-		token, err := exractToken(r.Header)
-		if err != nil {
-			log.Error("failed get JWT token", sl.Err(err))
-			render.JSON(w, r, resp.Error(err.Error()))
-			return
-		}
+		// sso checks that the user is a creator of the app
+		token := "Bearer " + get.MustPrincipal(r.Context()).Token
 		ctx := metadata.NewOutgoingContext(r.Context(), metadata.Pairs("Authorization", token))
 
 		_, err = permProvider.DelAdmin(ctx, req.Email, req.AppID)
 		if err != nil {
-			errExpect := "grpc.DelAdmin: rpc error: code = InvalidArgument desc = invalid credentials"
-			if err.Error() == errExpect {
-				log.Error("Invalid credential", sl.Err(err))
-				render.JSON(w, r, resp.Error("Invalid credential"))
-				return
-			}
-			log.Error("error to set admin", sl.Err(err))
-			render.JSON(w, r, resp.Error(err.Error()))
+			responseSSOError(w, r, log, err)
 			return
 		}
 		log.Info("admin delete")
@@ -95,3 +64,26 @@ func New(log *slog.Logger, permProvider PermissionDeleter) http.HandlerFunc {
 		render.JSON(w, r, Response{Response: resp.OK()})
 	}
 }
+
+func responseSSOError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, sso.ErrInvalidArgument):
+		log.Warn("invalid credentials", sl.Err(err))
+		resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid credentials")
+	case errors.Is(err, sso.ErrUnauthenticated):
+		log.Warn("token is rejected by sso", sl.Err(err))
+		resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthenticated, "invalid token")
+	case errors.Is(err, sso.ErrPermissionDenied):
+		log.Warn("user is not a creator", sl.Err(err))
+		resp.Error(w, r, http.StatusForbidden, resp.CodeForbidden, "you are not a creator")
+	case errors.Is(err, sso.ErrNotFound):
+		log.Warn("user was not found", sl.Err(err))
+		resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "user was not found")
+	case errors.Is(err, sso.ErrUnavailable):
+		log.Error("sso is unavailable", sl.Err(err))
+		resp.Error(w, r, http.StatusServiceUnavailable, resp.CodeUnavailable, "sso is unavailable")
+	default:
+		log.Error("failed to delete admin", sl.Err(err))
+		resp.Internal(w, r)
+	}
+}
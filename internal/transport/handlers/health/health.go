@@ -0,0 +1,48 @@
+package health
+
+import (
+	"context"
+	"github.com/neepooha/url_shortener/internal/health"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=ReadinessChecker
+type ReadinessChecker interface {
+	Check(ctx context.Context) health.Report
+}
+
+// NewLive answers while the process can serve http at all
+func NewLive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// readyResponse has only names and statuses of checks, the probe is public
+// and errors of checks are logged instead
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// NewReady answers 503 with failed dependencies or while shutting down
+func NewReady(log *slog.Logger, checker ReadinessChecker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.health.NewReady"
+
+		report := checker.Check(r.Context())
+		if !report.OK() {
+			log.Warn("service is not ready", slog.String("op", op), slog.Any("report", report))
+			render.Status(r, http.StatusServiceUnavailable)
+		}
+		res := readyResponse{Status: report.Status, Checks: make(map[string]string, len(report.Checks))}
+		for name, check := range report.Checks {
+			res.Checks[name] = check.Status
+		}
+		render.JSON(w, r, res)
+	}
+}
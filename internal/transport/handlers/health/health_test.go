@@ -0,0 +1,36 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("postgres", func(context.Context) error { return nil })
+	checker.Add("sso", func(context.Context) error { return errors.New("dial tcp 10.0.0.7:44044: connection refused") })
+
+	w := httptest.NewRecorder()
+	NewReady(slog.New(slog.NewTextHandler(io.Discard, nil)), checker).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "10.0.0.7", "errors are only logged")
+	var res readyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Equal(t, readyResponse{
+		Status: health.StatusFail,
+		Checks: map[string]string{"postgres": health.StatusOK, "sso": health.StatusFail},
+	}, res)
+}
@@ -0,0 +1,251 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/transport/handlers/url/save"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Request struct {
+	Items []save.Request `json:"items"`
+	// Atomic saves all items in one transaction or none of them,
+	// otherwise every valid item is saved on its own
+	Atomic bool `json:"atomic"`
+}
+
+type Response struct {
+	resp.Response
+	Saved  int          `json:"saved"`
+	Failed int          `json:"failed"`
+	Items  []ItemResult `json:"items"`
+}
+
+// ItemResult is the result of the item with the same index in request
+type ItemResult struct {
+	Index int        `json:"index"`
+	Alias string     `json:"alias,omitempty"`
+	Error *ItemError `json:"error,omitempty"`
+}
+
+type ItemError struct {
+	Status        int                 `json:"status"`
+	Code          string              `json:"code"`
+	Detail        string              `json:"detail"`
+	InvalidParams []resp.InvalidParam `json:"invalid_params,omitempty"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLBatchSaver
+type URLBatchSaver interface {
+	save.URLSaver
+	SaveURLs(ctx context.Context, urls []storage.NewURL) error
+}
+
+// attempts to save atomic batch when a generated alias is taken
+const atomicAttempts = 3
+
+// New saves up to maxItems links at once
+func New(log *slog.Logger, urlSaver URLBatchSaver, aliasGenerator save.AliasGenerator, aliasPolicy save.AliasPolicy, maxItems int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.batch.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		user := get.MustPrincipal(r.Context())
+		uid := user.UID
+		appID := user.AppID
+
+		// decode json request
+		var req Request
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "failed to decode request")
+			return
+		}
+		if len(req.Items) == 0 || len(req.Items) > maxItems {
+			log.Info("invalid number of items", slog.Int("items", len(req.Items)))
+			resp.InvalidRequest(w, r, []resp.InvalidParam{{Name: "items", Reason: fmt.Sprintf("must contain from 1 to %d items", maxItems)}})
+			return
+		}
+		log.Info("request body decoded", slog.Int("items", len(req.Items)), slog.Bool("atomic", req.Atomic))
+
+		// validate every item, custom aliases must be unique in the batch
+		results := make([]ItemResult, len(req.Items))
+		valid := make([]bool, len(req.Items))
+		aliases := make(map[string]bool, len(req.Items))
+		now := time.Now()
+		for i := range req.Items {
+			results[i].Index = i
+			item := &req.Items[i]
+			if params := item.Validate(aliasPolicy, now); params != nil {
+				results[i].Error = &ItemError{
+					Status:        http.StatusBadRequest,
+					Code:          resp.CodeValidationFailed,
+					Detail:        "item has invalid fields",
+					InvalidParams: params,
+				}
+				continue
+			}
+			if item.Alias != "" && aliases[item.Alias] {
+				results[i].Error = itemError(storage.ErrURLExists)
+				continue
+			}
+			aliases[item.Alias] = true
+			valid[i] = true
+		}
+
+		if req.Atomic {
+			saveAtomic(r.Context(), log, urlSaver, aliasGenerator, aliasPolicy, req.Items, results, valid, uid, appID)
+		} else {
+			for i, item := range req.Items {
+				if !valid[i] {
+					continue
+				}
+				alias, err := save.Save(r.Context(), urlSaver, aliasGenerator, aliasPolicy, item, uid, appID)
+				if err != nil {
+					logSaveError(log, i, err)
+					results[i].Error = itemError(err)
+					continue
+				}
+				results[i].Alias = alias
+			}
+		}
+
+		res := Response{Response: resp.OK(), Items: results}
+		for _, item := range results {
+			if item.Error != nil {
+				res.Failed++
+			} else {
+				res.Saved++
+			}
+		}
+		log.Info("batch is processed", slog.Int("saved", res.Saved), slog.Int("failed", res.Failed))
+
+		render.JSON(w, r, res)
+	}
+}
+
+// saveAtomic saves all items in one transaction. If any item is invalid or fails,
+// nothing is saved and other items are marked as aborted.
+func saveAtomic(ctx context.Context, log *slog.Logger, urlSaver URLBatchSaver, aliasGenerator save.AliasGenerator,
+	aliasPolicy save.AliasPolicy, items []save.Request, results []ItemResult, valid []bool, uid uint64, appID int,
+) {
+	abort := func() {
+		for i := range results {
+			if results[i].Error == nil {
+				results[i].Alias = ""
+				results[i].Error = &ItemError{
+					Status: http.StatusFailedDependency,
+					Code:   resp.CodeBatchAborted,
+					Detail: "batch is not saved because of another item",
+				}
+			}
+		}
+	}
+	for _, ok := range valid {
+		if !ok {
+			abort()
+			return
+		}
+	}
+
+	urls := make([]storage.NewURL, len(items))
+	generated := make([]bool, len(items))
+	taken := make(map[string]bool, len(items))
+	for i, item := range items {
+		urls[i] = storage.NewURL{
+			URL:      item.URL,
+			Alias:    item.Alias,
+			OwnerUID: uid,
+			AppID:    appID,
+			Opts:     storage.SaveOptions{ExpiresAt: item.ExpiresAt, MaxClicks: item.MaxClicks},
+		}
+		if item.Alias != "" {
+			taken[item.Alias] = true
+		}
+	}
+	// generate aliases to be checked by the transaction
+	generate := func(i int) error {
+		_, err := aliasGenerator.Generate(ctx, func(alias string, id int64) error {
+			if taken[alias] || aliasPolicy.Reserved(alias) {
+				return storage.ErrURLExists
+			}
+			taken[alias] = true
+			urls[i].Alias = alias
+			urls[i].Opts.ID = id
+			return nil
+		})
+		return err
+	}
+	for i, item := range items {
+		if item.Alias != "" {
+			continue
+		}
+		if err := generate(i); err != nil {
+			logSaveError(log, i, err)
+			results[i].Error = itemError(err)
+			abort()
+			return
+		}
+		generated[i] = true
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := urlSaver.SaveURLs(ctx, urls)
+		if err == nil {
+			break
+		}
+		var batchErr *storage.BatchError
+		if !errors.As(err, &batchErr) {
+			log.Error("failed to save batch", sl.Err(err))
+			for i := range results {
+				results[i].Error = itemError(err)
+			}
+			return
+		}
+		// generated alias is taken by a link saved meanwhile, try another one
+		i := batchErr.Index
+		if generated[i] && errors.Is(err, storage.ErrURLExists) && attempt < atomicAttempts {
+			if err := generate(i); err == nil {
+				continue
+			}
+		}
+		logSaveError(log, i, err)
+		results[i].Error = itemError(err)
+		abort()
+		return
+	}
+	for i := range results {
+		results[i].Alias = urls[i].Alias
+	}
+}
+
+func itemError(err error) *ItemError {
+	status, code, detail := save.ClassifyError(err)
+	return &ItemError{Status: status, Code: code, Detail: detail}
+}
+
+func logSaveError(log *slog.Logger, index int, err error) {
+	status, _, _ := save.ClassifyError(err)
+	if status == http.StatusInternalServerError {
+		log.Error("failed to add url", slog.Int("index", index), sl.Err(err))
+		return
+	}
+	log.Warn("url is not added", slog.Int("index", index), sl.Err(err))
+}
@@ -0,0 +1,111 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/neepooha/url_shortener/internal/lib/aliaspolicy"
+	"github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/random"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHandler(t *testing.T, st *memory.Storage) http.HandlerFunc {
+	t.Helper()
+
+	policy, err := aliaspolicy.New("A-Za-z0-9_-", 3, 64, false)
+	require.NoError(t, err)
+	policy.Reserve("url")
+	gen := random.NewGenerator("abcdefghijklmnopqrstuvwxyz", 8, 8, 5, 0)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(log, st, gen, policy, 3)
+}
+
+func doBatch(t *testing.T, h http.HandlerFunc, body string) (int, Response) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/url/batch", bytes.NewBufferString(body))
+	ctx := get.WithPrincipal(r.Context(), &get.Principal{UID: 1, AppID: 1})
+	w := httptest.NewRecorder()
+	h(w, r.WithContext(ctx))
+
+	var res Response
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	}
+	return w.Code, res
+}
+
+func TestBestEffort(t *testing.T) {
+	st := memory.NewStorage()
+	require.NoError(t, st.SaveURL(context.Background(), "https://habr.com/", "habr", 2, 1, storage.SaveOptions{}))
+	h := newHandler(t, st)
+
+	code, res := doBatch(t, h, `{"items": [
+		{"url": "https://go.dev/", "alias": "golang"},
+		{"url": "https://go.dev/doc/"},
+		{"url": "not a url"},
+		{"url": "https://go.dev/", "alias": "habr"}
+	]}`)
+	require.Equal(t, http.StatusBadRequest, code, "more than max items")
+
+	code, res = doBatch(t, h, `{"items": [
+		{"url": "https://go.dev/", "alias": "golang"},
+		{"url": "https://go.dev/doc/"},
+		{"url": "https://go.dev/", "alias": "habr"}
+	]}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, res.Saved)
+	assert.Equal(t, 1, res.Failed)
+	assert.Equal(t, "golang", res.Items[0].Alias)
+	assert.Len(t, res.Items[1].Alias, 8)
+	require.NotNil(t, res.Items[2].Error)
+	assert.Equal(t, response.CodeAliasExists, res.Items[2].Error.Code)
+
+	resURL, err := st.GetURL(context.Background(), res.Items[1].Alias)
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev/doc/", resURL)
+}
+
+func TestAtomic(t *testing.T) {
+	st := memory.NewStorage()
+	require.NoError(t, st.SaveURL(context.Background(), "https://habr.com/", "habr", 2, 1, storage.SaveOptions{}))
+	h := newHandler(t, st)
+
+	// invalid item aborts the batch
+	_, res := doBatch(t, h, `{"atomic": true, "items": [
+		{"url": "https://go.dev/", "alias": "golang"},
+		{"url": "https://go.dev/", "alias": "url"}
+	]}`)
+	assert.Equal(t, 0, res.Saved)
+	assert.Equal(t, response.CodeBatchAborted, res.Items[0].Error.Code)
+	assert.Equal(t, response.CodeValidationFailed, res.Items[1].Error.Code)
+	assert.Equal(t, []response.InvalidParam{{Name: "alias", Reason: "is reserved"}}, res.Items[1].Error.InvalidParams)
+
+	// conflict in storage aborts the batch
+	_, res = doBatch(t, h, `{"atomic": true, "items": [
+		{"url": "https://go.dev/", "alias": "golang"},
+		{"url": "https://go.dev/", "alias": "habr"}
+	]}`)
+	assert.Equal(t, 0, res.Saved)
+	assert.Equal(t, response.CodeAliasExists, res.Items[1].Error.Code)
+	_, err := st.GetURL(context.Background(), "golang")
+	assert.ErrorIs(t, err, storage.ErrURLNotFound)
+
+	_, res = doBatch(t, h, `{"atomic": true, "items": [
+		{"url": "https://go.dev/", "alias": "golang"},
+		{"url": "https://go.dev/doc/"}
+	]}`)
+	assert.Equal(t, 2, res.Saved)
+	assert.Len(t, res.Items[1].Alias, 8)
+}
@@ -6,12 +6,11 @@ import (
 	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
 	"github.com/neepooha/url_shortener/internal/storage"
-	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
 	"log/slog"
 	"net/http"
 
-	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 )
 
@@ -28,30 +27,14 @@ func New(log *slog.Logger, urlDeleter URLDeleter) http.HandlerFunc {
 		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
-		IsAdmin, ok := get.IsAdminFromContext(r.Context())
-		if !ok {
-			if err, ok := get.ErrorFromContext(r.Context()); ok {
-				log.Error("failed to get IsAdminBool", sl.Err(err))
-				render.JSON(w, r, resp.Error("Internal error"))
-				return
-			}
-			log.Info("user without logging")
-			render.JSON(w, r, resp.Error("you are not logged into your account"))
-			return
-		}
-		if !IsAdmin {
-			log.Info("user aren't admin")
-			render.JSON(w, r, resp.Error("you are not admin to delete this"))
-			return
-		}
-
 		// get alias from url
 		alias := chi.URLParam(r, "alias")
 		if alias == "" {
 			log.Warn("alias is empty")
-			render.JSON(w, r, resp.Error("invalid request"))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
 			return
 		}
 		log.Info("alias was get from url", slog.String("alias", alias))
@@ -61,11 +44,11 @@ func New(log *slog.Logger, urlDeleter URLDeleter) http.HandlerFunc {
 		if err != nil {
 			if errors.Is(err, storage.ErrAliasNotFound) {
 				log.Warn("url by alias was not found", slog.String("alias", alias))
-				render.JSON(w, r, resp.Error("url by alias was not found"))
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "url by alias was not found")
 				return
 			}
 			log.Error("failed to delete url", sl.Err(err))
-			render.JSON(w, r, resp.Error("internal error"))
+			resp.Internal(w, r)
 			return
 		}
 		log.Info("delete alias", slog.String("alias", alias))
@@ -0,0 +1,139 @@
+package delete
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/neepooha/url_shortener/internal/lib/token"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	"github.com/neepooha/url_shortener/internal/transport/middleware/auth"
+	"github.com/neepooha/url_shortener/internal/transport/middleware/isadmin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	secret = "test-secret"
+	owner  = 1
+	admin  = 2
+	other  = 3
+)
+
+// admins are users with admin rights in app 1
+type admins map[uint64]bool
+
+func (a admins) IsAdmin(_ context.Context, uid uint64, appID int) (bool, error) {
+	return appID == 1 && a[uid], nil
+}
+
+// unavailable is sso which fails to check admins
+type unavailable struct{}
+
+func (unavailable) IsAdmin(context.Context, uint64, int) (bool, error) {
+	return false, errors.New("sso is unavailable")
+}
+
+// newRouter wires handler like the app does
+func newRouter(t *testing.T, st *memory.Storage, perms isadmin.PermissionProvider) http.Handler {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	verifier, err := token.NewVerifier(token.Secret(secret), token.Options{Methods: []string{"HS256"}})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Route("/url", func(r chi.Router) {
+		r.Use(auth.New(log, verifier), auth.RequireAuth(log))
+		r.Route("/{alias}", func(r chi.Router) {
+			r.Use(isadmin.RequireOwnerOrAdmin(log, perms, st))
+			r.Delete("/", New(log, st))
+		})
+	})
+	return router
+}
+
+func bearer(t *testing.T, uid uint64, appID int) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":    uid,
+		"app_id": appID,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return "Bearer " + s
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		perms  isadmin.PermissionProvider
+		want   int
+	}{
+		{"admin", bearer(t, admin, 1), admins{admin: true}, http.StatusOK},
+		{"owner", bearer(t, owner, 1), admins{admin: true}, http.StatusOK},
+		{"owner when admin check fails", bearer(t, owner, 1), unavailable{}, http.StatusOK},
+		{"other user", bearer(t, other, 1), admins{admin: true}, http.StatusNotFound},
+		{"other user when admin check fails", bearer(t, other, 1), unavailable{}, http.StatusServiceUnavailable},
+		{"admin of another app", bearer(t, admin, 2), admins{admin: true}, http.StatusNotFound},
+		{"anonymous", "", admins{admin: true}, http.StatusUnauthorized},
+		{"invalid token", "Bearer broken", admins{admin: true}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.NewStorage()
+			require.NoError(t, st.SaveURL(context.Background(), "https://example.com", "link", owner, 1, storage.SaveOptions{}))
+
+			r := httptest.NewRequest(http.MethodDelete, "/url/link", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			newRouter(t, st, tt.perms).ServeHTTP(w, r)
+
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+			_, err := st.GetURLOwner(context.Background(), "link")
+			if tt.want == http.StatusOK {
+				assert.ErrorIs(t, err, storage.ErrAliasNotFound)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// links of others look like missing ones, so aliases can't be probed
+func TestDeleteNotFound(t *testing.T) {
+	st := memory.NewStorage()
+	require.NoError(t, st.SaveURL(context.Background(), "https://example.com", "link", owner, 1, storage.SaveOptions{}))
+	router := newRouter(t, st, admins{admin: true})
+
+	for _, tt := range []struct {
+		name  string
+		alias string
+		uid   uint64
+	}{
+		{"admin, missing link", "missing", admin},
+		{"other user, missing link", "missing", other},
+		{"other user, existing link", "link", other},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodDelete, "/url/"+tt.alias, nil)
+			r.Header.Set("Authorization", bearer(t, tt.uid, 1))
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Contains(t, w.Body.String(), `"detail":"url by alias was not found"`)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/linkio"
+	"github.com/neepooha/url_shortener/internal/storage"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLLister
+type URLLister interface {
+	linkio.ExportStorage
+}
+
+// New streams links of the authorized user, the response isn't buffered whatever its size.
+// Query params: format (csv or ndjson), owner, all (admins only).
+// Every page has pageTimeout to be written, so an export isn't cut by the write timeout of the server.
+func New(log *slog.Logger, urlLister URLLister, pageTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.export.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		user := get.MustPrincipal(r.Context())
+		uid := user.UID
+		isAdmin := user.IsAdmin()
+
+		// parse query
+		q := r.URL.Query()
+		format := linkio.FormatCSV
+		if f := q.Get("format"); f != "" {
+			var err error
+			if format, err = linkio.FormatOf(f); err != nil {
+				log.Info("unknown format", slog.String("format", f))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, err.Error())
+				return
+			}
+		}
+		filter := storage.ListFilter{OwnerUID: &uid}
+		owner, all := q.Get("owner"), q.Get("all") == "true"
+		if (owner != "" || all) && !isAdmin {
+			log.Info("user aren't admin", slog.Uint64("uid", uid))
+			resp.Error(w, r, http.StatusForbidden, resp.CodeForbidden, "you are not admin to export links of other users")
+			return
+		}
+		if all {
+			filter.OwnerUID = nil
+		} else if owner != "" {
+			ownerUID, err := strconv.ParseUint(owner, 10, 64)
+			if err != nil {
+				log.Warn("invalid owner", slog.String("owner", owner))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid owner")
+				return
+			}
+			filter.OwnerUID = &ownerUID
+		}
+
+		writer, err := linkio.NewWriter(w, format)
+		if err != nil {
+			log.Error("failed to create writer", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", linkio.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links.%s"`, format))
+
+		// send every page as soon as it's read and give time to the next one
+		rc := http.NewResponseController(w)
+		extend := func() error {
+			err := rc.SetWriteDeadline(time.Now().Add(pageTimeout))
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+			return nil
+		}
+		if err := extend(); err != nil {
+			log.Error("failed to set write deadline", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		sent := false
+		flush := func() error {
+			sent = true
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+			return extend()
+		}
+		total, err := linkio.Export(r.Context(), urlLister, writer, filter, flush)
+		if err != nil {
+			log.Error("failed to export links", sl.Err(err), slog.Int("exported", total))
+			if !sent {
+				resp.Internal(w, r)
+			}
+			// otherwise status is already sent and the client sees a truncated body
+			return
+		}
+		log.Info("links exported", slog.Int("exported", total))
+	}
+}
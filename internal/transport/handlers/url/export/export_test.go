@@ -0,0 +1,64 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowLister takes delay to read every page
+type slowLister struct {
+	*memory.Storage
+	delay time.Duration
+}
+
+func (l slowLister) ListURLs(ctx context.Context, filter storage.ListFilter) ([]storage.URL, error) {
+	time.Sleep(l.delay)
+	return l.Storage.ListURLs(ctx, filter)
+}
+
+func TestExportPages(t *testing.T) {
+	ctx := context.Background()
+	st := memory.NewStorage()
+	// four pages of export
+	const links = 3001
+	for i := 0; i < links; i++ {
+		require.NoError(t, st.SaveURL(ctx, "https://go.dev/", fmt.Sprintf("go%d", i), 1, 1, storage.SaveOptions{}))
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	export := New(log, slowLister{Storage: st, delay: 100 * time.Millisecond}, 300*time.Millisecond)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(get.WithPrincipal(r.Context(), &get.Principal{UID: 1, AppID: 1}))
+		export(w, r)
+	}))
+	// the whole export takes longer than the server allows to write a response
+	srv.Config.WriteTimeout = 150 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?format=ndjson")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	lines := 0
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		lines++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, links, lines)
+}
@@ -0,0 +1,78 @@
+package history
+
+import (
+	"context"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Revision struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	ChangedBy uint64    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type Response struct {
+	resp.Response
+	Revisions []Revision `json:"revisions"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=RevisionsGetter
+type RevisionsGetter interface {
+	ListURLRevisions(ctx context.Context, alias string) ([]storage.Revision, error)
+}
+
+// New returns previous destinations of the link, newest first. Only owner or admin can see them.
+func New(log *slog.Logger, revGetter RevisionsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.history.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		// get alias from url
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Warn("alias is empty")
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
+			return
+		}
+		log.Info("alias was get from url", slog.String("alias", alias))
+
+		revs, err := revGetter.ListURLRevisions(r.Context(), alias)
+		if err != nil {
+			log.Error("failed to list revisions", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		log.Info("got url history", slog.Int("count", len(revs)))
+
+		// response OK
+		revisions := make([]Revision, 0, len(revs))
+		for _, rev := range revs {
+			revisions = append(revisions, Revision{
+				ID:        rev.ID,
+				URL:       rev.URL,
+				ChangedBy: rev.ChangedBy,
+				ChangedAt: rev.ChangedAt,
+			})
+		}
+		render.JSON(w, r, Response{
+			Response:  resp.OK(),
+			Revisions: revisions,
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/linkio"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// deadlineReader gives every read of the body readTimeout,
+// so a long import is limited by its pace and not by its size
+type deadlineReader struct {
+	io.Reader
+	rc          *http.ResponseController
+	readTimeout time.Duration
+}
+
+func (d deadlineReader) Read(p []byte) (int, error) {
+	err := d.rc.SetReadDeadline(time.Now().Add(d.readTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return d.Reader.Read(p)
+}
+
+type Response struct {
+	resp.Response
+	linkio.Report
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=LinkImporter
+type LinkImporter interface {
+	Import(ctx context.Context, r *linkio.Reader, opts linkio.ImportOptions) (linkio.Report, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=PermissionProvider
+type PermissionProvider interface {
+	IsAdmin(ctx context.Context, userID uint64, appID int) (bool, error)
+}
+
+// New imports links from CSV or NDJSON body.
+// Query params: format (csv or ndjson, by default taken from Content-Type), dry_run, conflict (skip, overwrite or fail).
+// SSO is asked if the user is admin only when the body has links of other users.
+// Read and write deadlines of the server are extended by timeout while the body is read,
+// so an import isn't cut by them.
+func New(log *slog.Logger, importer LinkImporter, permProvider PermissionProvider, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.importer.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		user := get.MustPrincipal(r.Context())
+		uid := user.UID
+		appID := user.AppID
+
+		// parse query
+		q := r.URL.Query()
+		format := q.Get("format")
+		if format == "" {
+			format = r.Header.Get("Content-Type")
+		}
+		format, err := linkio.FormatOf(format)
+		if err != nil {
+			log.Info("unknown format", slog.String("format", format))
+			resp.Error(w, r, http.StatusUnsupportedMediaType, resp.CodeInvalidRequest, err.Error())
+			return
+		}
+		opts := linkio.ImportOptions{
+			DryRun:   q.Get("dry_run") == "true",
+			Conflict: q.Get("conflict"),
+			UID:      uid,
+			AppID:    appID,
+			AnyOwner: func(ctx context.Context) (bool, error) {
+				isAdmin, err := permProvider.IsAdmin(ctx, uid, appID)
+				if err != nil {
+					return false, fmt.Errorf("%w: %w", get.ErrFailedIsAdminCheck, err)
+				}
+				return isAdmin, nil
+			},
+		}
+
+		rc := http.NewResponseController(w)
+		body := deadlineReader{Reader: r.Body, rc: rc, readTimeout: timeout}
+		reader, err := linkio.NewReader(body, format)
+		if err != nil {
+			log.Error("failed to create reader", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		report, err := importer.Import(r.Context(), reader, opts)
+		// the response is written after the whole import
+		if err := rc.SetWriteDeadline(time.Now().Add(timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			log.Error("failed to set write deadline", sl.Err(err))
+			return
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, linkio.ErrUnknownConflict), errors.Is(err, linkio.ErrInvalidHeader):
+				log.Info("invalid import", sl.Err(err))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, err.Error())
+			case errors.Is(err, get.ErrFailedIsAdminCheck):
+				log.Error("failed to check if user is admin", sl.Err(err), slog.Any("report", report))
+				resp.Error(w, r, http.StatusServiceUnavailable, resp.CodeUnavailable, "failed to check if user is admin, try again")
+			default:
+				log.Error("failed to import links", sl.Err(err), slog.Any("report", report))
+				resp.Internal(w, r)
+			}
+			return
+		}
+		log.Info("links imported",
+			slog.Bool("dry_run", report.DryRun),
+			slog.Int("created", report.Created),
+			slog.Int("overwritten", report.Overwritten),
+			slog.Int("skipped", report.Skipped),
+			slog.Int("failed", report.Failed),
+		)
+
+		// response OK
+		render.JSON(w, r, Response{Response: resp.OK(), Report: report})
+	}
+}
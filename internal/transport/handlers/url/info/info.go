@@ -0,0 +1,87 @@
+package info
+
+import (
+	"context"
+	"errors"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Response struct {
+	resp.Response
+	Alias        string     `json:"alias"`
+	URL          string     `json:"url"`
+	OwnerUID     uint64     `json:"owner_uid"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	RedirectType int        `json:"redirect_type"`
+	Clicks       int64      `json:"clicks"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxClicks    int64      `json:"max_clicks,omitempty"`
+	UsedClicks   int64      `json:"used_clicks,omitempty"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLInfoGetter
+type URLInfoGetter interface {
+	GetURLInfo(ctx context.Context, alias string) (storage.URL, error)
+}
+
+// New returns details of the link instead of redirecting. Only owner or admin can see them.
+func New(log *slog.Logger, urlGetter URLInfoGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.info.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		// get alias from url
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Warn("alias is empty")
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
+			return
+		}
+		log.Info("alias was get from url", slog.String("alias", alias))
+
+		// get link by alias
+		info, err := urlGetter.GetURLInfo(r.Context(), alias)
+		if err != nil {
+			if errors.Is(err, storage.ErrURLNotFound) {
+				log.Warn("url by alias was not found", slog.String("alias", alias))
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "url by alias was not found")
+				return
+			}
+			log.Error("failed to get url info", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		log.Info("got url info", slog.String("alias", alias))
+
+		// response OK
+		render.JSON(w, r, Response{
+			Response:     resp.OK(),
+			Alias:        info.Alias,
+			URL:          info.URL,
+			OwnerUID:     info.OwnerUID,
+			CreatedAt:    info.CreatedAt,
+			UpdatedAt:    info.UpdatedAt,
+			RedirectType: info.RedirectType,
+			Clicks:       info.Clicks,
+			ExpiresAt:    info.ExpiresAt,
+			MaxClicks:    info.MaxClicks,
+			UsedClicks:   info.UsedClicks,
+		})
+	}
+}
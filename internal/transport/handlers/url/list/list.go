@@ -0,0 +1,179 @@
+package list
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Link struct {
+	Alias     string    `json:"alias"`
+	URL       string    `json:"url"`
+	OwnerUID  uint64    `json:"owner_uid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Response struct {
+	resp.Response
+	Links      []Link `json:"links"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLLister
+type URLLister interface {
+	ListURLs(ctx context.Context, filter storage.ListFilter) ([]storage.URL, error)
+}
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// New returns links of the authorized user.
+// Query params: owner, all (admins only), alias_prefix, host, sort (created_at or -created_at), limit, cursor.
+func New(log *slog.Logger, urlLister URLLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.list.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		user := get.MustPrincipal(r.Context())
+		uid := user.UID
+		isAdmin := user.IsAdmin()
+
+		// parse query
+		q := r.URL.Query()
+		filter := storage.ListFilter{
+			OwnerUID:    &uid,
+			AliasPrefix: q.Get("alias_prefix"),
+			Host:        q.Get("host"),
+		}
+		owner, all := q.Get("owner"), q.Get("all") == "true"
+		if (owner != "" || all) && !isAdmin {
+			log.Info("user aren't admin", slog.Uint64("uid", uid))
+			resp.Error(w, r, http.StatusForbidden, resp.CodeForbidden, "you are not admin to list links of other users")
+			return
+		}
+		if all {
+			filter.OwnerUID = nil
+		} else if owner != "" {
+			ownerUID, err := strconv.ParseUint(owner, 10, 64)
+			if err != nil {
+				log.Warn("invalid owner", slog.String("owner", owner))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid owner")
+				return
+			}
+			filter.OwnerUID = &ownerUID
+		}
+
+		limit := defaultLimit
+		if l := q.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 || n > maxLimit {
+				log.Warn("invalid limit", slog.String("limit", l))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+				return
+			}
+			limit = n
+		}
+
+		switch q.Get("sort") {
+		case "", "-created_at":
+		case "created_at":
+			filter.Asc = true
+		default:
+			log.Warn("invalid sort", slog.String("sort", q.Get("sort")))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "sort must be created_at or -created_at")
+			return
+		}
+
+		if c := q.Get("cursor"); c != "" {
+			cursor, err := decodeCursor(c)
+			if err != nil {
+				log.Warn("invalid cursor", sl.Err(err))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid cursor")
+				return
+			}
+			filter.After = &cursor
+		}
+
+		// ask one more link to know if there is a next page
+		filter.Limit = limit + 1
+		urls, err := urlLister.ListURLs(r.Context(), filter)
+		if err != nil {
+			log.Error("failed to list urls", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+
+		var nextCursor string
+		if len(urls) > limit {
+			urls = urls[:limit]
+			last := urls[len(urls)-1]
+			nextCursor = encodeCursor(storage.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		}
+		log.Info("urls listed", slog.Int("count", len(urls)))
+
+		// response OK
+		links := make([]Link, 0, len(urls))
+		for _, u := range urls {
+			links = append(links, Link{
+				Alias:     u.Alias,
+				URL:       u.URL,
+				OwnerUID:  u.OwnerUID,
+				CreatedAt: u.CreatedAt,
+			})
+		}
+		render.JSON(w, r, Response{
+			Response:   resp.OK(),
+			Links:      links,
+			NextCursor: nextCursor,
+		})
+	}
+}
+
+// encodeCursor packs cursor into opaque url-safe string
+func encodeCursor(c storage.Cursor) string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (storage.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return storage.Cursor{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return storage.Cursor{}, ErrInvalidCursor
+	}
+	micro, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return storage.Cursor{}, ErrInvalidCursor
+	}
+	cursorID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return storage.Cursor{}, ErrInvalidCursor
+	}
+	return storage.Cursor{CreatedAt: time.UnixMicro(micro).UTC(), ID: cursorID}, nil
+}
@@ -3,23 +3,43 @@ package redirect
 import (
 	"context"
 	"errors"
+	"github.com/neepooha/url_shortener/internal/clicks"
 	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
 	"github.com/neepooha/url_shortener/internal/storage"
 	"log/slog"
+	"net"
 	"net/http"
+	"time"
 
-	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLGetter
 type URLGetter interface {
-	GetURL(ctx context.Context, alias string) (string, error)
+	GetURLInfo(ctx context.Context, alias string) (storage.URL, error)
+	ConsumeClick(ctx context.Context, alias string) error
 }
 
-func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=ClickRecorder
+type ClickRecorder interface {
+	Record(e clicks.Event)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=RedirectCounter
+type RedirectCounter interface {
+	CountRedirect(result string)
+}
+
+// results of redirect for RedirectCounter
+const (
+	resultHit  = "hit"
+	resultMiss = "miss"
+	resultGone = "gone"
+)
+
+func New(log *slog.Logger, urlGetter URLGetter, clickRecorder ClickRecorder, redirectCounter RedirectCounter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.url.redirect.New"
 
@@ -27,32 +47,83 @@ func New(log *slog.Logger, urlGetter URLGetter) http.HandlerFunc {
 		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
 		// get alias from url
 		alias := chi.URLParam(r, "alias")
 		if alias == "" {
 			log.Warn("alias is empty")
-			render.JSON(w, r, resp.Error("invalid request"))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
 			return
 		}
 		log.Info("alias was get from url", slog.String("alias", alias))
 
-		// get resURL by alias
-		resURL, err := urlGetter.GetURL(r.Context(), alias)
+		// get link by alias
+		link, err := urlGetter.GetURLInfo(r.Context(), alias)
 		if err != nil {
 			if errors.Is(err, storage.ErrURLNotFound) {
 				log.Warn("wrong alias", slog.String("alias", alias))
-				render.JSON(w, r, resp.Error("wrong alias"))
+				redirectCounter.CountRedirect(resultMiss)
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "wrong alias")
 				return
 			}
 			log.Error("failed to get url", sl.Err(err))
-			render.JSON(w, r, resp.Error("internal error"))
+			resp.Internal(w, r)
+			return
+		}
+		if link.Expired(time.Now()) {
+			log.Info("link is expired", slog.String("alias", alias))
+			redirectCounter.CountRedirect(resultGone)
+			responseGone(w, r)
 			return
 		}
-		log.Info("got url", slog.String("url", resURL))
 
-		// redirect to resURL
-		http.Redirect(w, r, resURL, http.StatusFound)
+		// count click against the limit of the link
+		if link.MaxClicks > 0 {
+			err := urlGetter.ConsumeClick(r.Context(), alias)
+			if err != nil {
+				if errors.Is(err, storage.ErrURLExhausted) || errors.Is(err, storage.ErrURLNotFound) {
+					log.Info("link clicks are exhausted", slog.String("alias", alias))
+					redirectCounter.CountRedirect(resultGone)
+					responseGone(w, r)
+					return
+				}
+				log.Error("failed to consume click", sl.Err(err))
+				resp.Internal(w, r)
+				return
+			}
+		}
+		log.Info("got url", slog.String("url", link.URL))
+		redirectCounter.CountRedirect(resultHit)
+
+		// record click in background
+		clickRecorder.Record(clicks.Event{
+			Alias:     alias,
+			Time:      time.Now(),
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			IP:        remoteIP(r),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+
+		// redirect to url of the link
+		redirectType := link.RedirectType
+		if redirectType == 0 {
+			redirectType = storage.DefaultRedirectType
+		}
+		http.Redirect(w, r, link.URL, redirectType)
+	}
+}
+
+func responseGone(w http.ResponseWriter, r *http.Request) {
+	resp.Error(w, r, http.StatusGone, resp.CodeLinkExpired, "link is expired")
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return ip
 }
@@ -0,0 +1,121 @@
+package redirect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/neepooha/url_shortener/internal/clicks"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder keeps recorded clicks
+type recorder struct {
+	events []clicks.Event
+}
+
+func (r *recorder) Record(e clicks.Event) {
+	r.events = append(r.events, e)
+}
+
+// counter keeps results of redirects
+type counter struct {
+	results []string
+}
+
+func (c *counter) CountRedirect(result string) {
+	c.results = append(c.results, result)
+}
+
+// broken is storage which fails to read links
+type broken struct {
+	*memory.Storage
+}
+
+func (broken) GetURLInfo(context.Context, string) (storage.URL, error) {
+	return storage.URL{}, errors.New("db is down")
+}
+
+// racing is storage where another visitor takes the last click
+// right after the link is read
+type racing struct {
+	*memory.Storage
+}
+
+func (r racing) GetURLInfo(ctx context.Context, alias string) (storage.URL, error) {
+	link, err := r.Storage.GetURLInfo(ctx, alias)
+	if err != nil {
+		return link, err
+	}
+	return link, r.Storage.ConsumeClick(ctx, alias)
+}
+
+// newRouter wires handler like the app does
+func newRouter(st URLGetter, rec *recorder, cnt *counter) http.Handler {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router := chi.NewRouter()
+	router.Get("/{alias}", New(log, st, rec, cnt))
+	return router
+}
+
+func TestRedirect(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name  string
+		alias string
+		// clicks made before the checked one
+		clicks int
+		wrap   func(st *memory.Storage) URLGetter
+		want   int
+		result string
+	}{
+		{name: "link", alias: "link", want: http.StatusFound, result: resultHit},
+		{name: "missing link", alias: "missing", want: http.StatusNotFound, result: resultMiss},
+		{name: "expired link", alias: "expired", want: http.StatusGone, result: resultGone},
+		{name: "last click of limited link", alias: "limited", clicks: 1, want: http.StatusFound, result: resultHit},
+		{name: "exhausted link", alias: "limited", clicks: 2, want: http.StatusGone, result: resultGone},
+		{name: "last click taken by another visitor", alias: "limited", clicks: 1, wrap: func(st *memory.Storage) URLGetter { return racing{st} }, want: http.StatusGone, result: resultGone},
+		{name: "storage error", alias: "link", wrap: func(st *memory.Storage) URLGetter { return broken{st} }, want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st := memory.NewStorage()
+			require.NoError(t, st.SaveURL(ctx, "https://example.com", "link", 1, 1, storage.SaveOptions{}))
+			require.NoError(t, st.SaveURL(ctx, "https://example.com", "expired", 1, 1, storage.SaveOptions{ExpiresAt: &expired}))
+			require.NoError(t, st.SaveURL(ctx, "https://example.com", "limited", 1, 1, storage.SaveOptions{MaxClicks: 2}))
+			for i := 0; i < tt.clicks; i++ {
+				require.NoError(t, st.ConsumeClick(ctx, tt.alias))
+			}
+			var getter URLGetter = st
+			if tt.wrap != nil {
+				getter = tt.wrap(st)
+			}
+
+			rec, cnt := &recorder{}, &counter{}
+			w := httptest.NewRecorder()
+			newRouter(getter, rec, cnt).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+tt.alias, nil))
+
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+			if tt.result != "" {
+				assert.Equal(t, []string{tt.result}, cnt.results)
+			}
+			if tt.want == http.StatusFound {
+				assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+				require.Len(t, rec.events, 1)
+				assert.Equal(t, tt.alias, rec.events[0].Alias)
+			} else {
+				assert.Empty(t, rec.events, "only redirects are recorded")
+			}
+		})
+	}
+}
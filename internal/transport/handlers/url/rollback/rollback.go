@@ -0,0 +1,100 @@
+package rollback
+
+import (
+	"context"
+	"errors"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type Request struct {
+	RevisionID int64 `json:"revision_id" validate:"required"`
+}
+
+type Response struct {
+	resp.Response
+	Alias string `json:"alias"`
+	URL   string `json:"url"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLRollbacker
+type URLRollbacker interface {
+	RollbackURL(ctx context.Context, alias string, revisionID int64, changedBy uint64) (string, error)
+}
+
+// New restores destination of the link from one of its revisions. Only owner or admin can do it.
+func New(log *slog.Logger, urlRollbacker URLRollbacker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.rollback.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		// editor of the link, only owner or admin gets here
+		uid := get.MustPrincipal(r.Context()).UID
+
+		// get alias from url
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Warn("alias is empty")
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
+			return
+		}
+		log.Info("alias was get from url", slog.String("alias", alias))
+
+		// decode json request
+		var req Request
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "failed to decode request")
+			return
+		}
+		log.Info("request body decoded", slog.Any("request", req))
+
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			resp.ValidationError(w, r, validateErr)
+			return
+		}
+
+		restored, err := urlRollbacker.RollbackURL(r.Context(), alias, req.RevisionID, uid)
+		if err != nil {
+			if errors.Is(err, storage.ErrRevisionNotFound) {
+				log.Warn("revision was not found", slog.Int64("revision_id", req.RevisionID))
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "revision was not found")
+				return
+			}
+			if errors.Is(err, storage.ErrURLNotFound) {
+				log.Warn("url by alias was not found", slog.String("alias", alias))
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "url by alias was not found")
+				return
+			}
+			log.Error("failed to rollback url", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		log.Info("url rolled back", slog.String("alias", alias), slog.Int64("revision_id", req.RevisionID))
+
+		// response OK
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Alias:    alias,
+			URL:      restored,
+		})
+	}
+}
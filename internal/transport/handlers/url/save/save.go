@@ -3,13 +3,16 @@ package save
 import (
 	"context"
 	"errors"
+	"github.com/neepooha/url_shortener/internal/lib/aliaspolicy"
 	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
 	"github.com/neepooha/url_shortener/internal/lib/random"
+	"github.com/neepooha/url_shortener/internal/lib/sequence"
 	"github.com/neepooha/url_shortener/internal/storage"
 	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
@@ -17,8 +20,10 @@ import (
 )
 
 type Request struct {
-	URL   string `json:"url" validate:"required,url"`
-	Alias string `json:"alias"`
+	URL       string     `json:"url" validate:"required,url"`
+	Alias     string     `json:"alias" validate:"omitempty,alias"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks int64      `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
 }
 
 type Response struct {
@@ -28,12 +33,22 @@ type Response struct {
 
 //go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLSaver
 type URLSaver interface {
-	SaveURL(ctx context.Context, urlToSave string, alias string) error
+	SaveURL(ctx context.Context, urlToSave string, alias string, ownerUID uint64, appID int, opts storage.SaveOptions) error
 }
 
-const aliasLength = 6
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=AliasGenerator
+type AliasGenerator interface {
+	Generate(ctx context.Context, save func(alias string, id int64) error) (string, error)
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=AliasPolicy
+type AliasPolicy interface {
+	Normalize(alias string) string
+	Reserved(alias string) bool
+	Struct(s any) error
+}
 
-func New(log *slog.Logger, urlSaver URLSaver) http.HandlerFunc {
+func New(log *slog.Logger, urlSaver URLSaver, aliasGenerator AliasGenerator, aliasPolicy AliasPolicy) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.url.save.New"
 
@@ -41,54 +56,40 @@ func New(log *slog.Logger, urlSaver URLSaver) http.HandlerFunc {
 		log := log.With(
 			slog.String("op", op),
 			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
 		)
 
-		if _, ok := get.UIDFromContext(r.Context()); !ok {
-			if err, ok := get.ErrorFromContext(r.Context()); ok {
-				log.Error("failed to get UID", sl.Err(err))
-				render.JSON(w, r, resp.Error("Internal Error"))
-				return
-			}
-			log.Info("user without logging")
-			render.JSON(w, r, resp.Error("you are not logged into your account"))
-			return
-		}
+		user := get.MustPrincipal(r.Context())
+		uid := user.UID
+		appID := user.AppID
 
 		// decode json request
 		var req Request
 		err := render.DecodeJSON(r.Body, &req)
 		if err != nil {
 			log.Error("failed to decode request body", sl.Err(err))
-			render.JSON(w, r, resp.Error("failed to decode request"))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "failed to decode request")
 			return
 		}
 		log.Info("request body decoded", slog.Any("request", req))
 
-		// validate url
-		if err := validator.New().Struct(req); err != nil {
-			validateErr := err.(validator.ValidationErrors)
-			log.Error("invalid request", sl.Err(err))
-			render.JSON(w, r, resp.ValidationError(validateErr))
+		// validate url and alias
+		if params := req.Validate(aliasPolicy, time.Now()); params != nil {
+			log.Info("invalid request", slog.Any("invalid_params", params))
+			resp.InvalidRequest(w, r, params)
 			return
 		}
 
-		// get alias from request or random
-		alias := req.Alias
-		if alias == "" {
-			// TODO if new alias = old alias in db
-			alias = random.NewRandomString(aliasLength)
-		}
-
-		// save url in DB
-		err = urlSaver.SaveURL(r.Context(), req.URL, alias)
+		// save url in DB with alias from request or random one
+		alias, err := Save(r.Context(), urlSaver, aliasGenerator, aliasPolicy, req, uid, appID)
 		if err != nil {
-			if errors.Is(err, storage.ErrURLExists) {
-				log.Warn("url already exists", slog.String("url", req.URL))
-				render.JSON(w, r, resp.Error("url already exists"))
-				return
+			status, code, detail := ClassifyError(err)
+			if status == http.StatusInternalServerError {
+				log.Error("failed to add url", sl.Err(err))
+			} else {
+				log.Warn("url is not added", slog.String("url", req.URL), sl.Err(err))
 			}
-			log.Error("failed to add url", sl.Err(err))
-			render.JSON(w, r, resp.Error("url already exists"))
+			resp.Error(w, r, status, code, detail)
 			return
 		}
 		log.Info("url added")
@@ -98,7 +99,64 @@ func New(log *slog.Logger, urlSaver URLSaver) http.HandlerFunc {
 	}
 }
 
+// Validate normalizes alias and checks the request.
+// It returns reasons of invalid fields or nil if request is valid.
+func (req *Request) Validate(aliasPolicy AliasPolicy, now time.Time) []resp.InvalidParam {
+	req.Alias = aliasPolicy.Normalize(req.Alias)
+	if err := aliasPolicy.Struct(req); err != nil {
+		var validateErr validator.ValidationErrors
+		if errors.As(err, &validateErr) {
+			params := resp.InvalidParams(validateErr)
+			for i, fieldErr := range validateErr {
+				if reason, ok := aliaspolicy.Reason(fieldErr.ActualTag()); ok {
+					params[i].Reason = reason
+				}
+			}
+			return params
+		}
+		return []resp.InvalidParam{{Name: "request", Reason: err.Error()}}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return []resp.InvalidParam{{Name: "expires_at", Reason: "must be in the future"}}
+	}
+	return nil
+}
+
+// Save saves url of the validated request with its alias or a generated one
+// and returns the alias
+func Save(ctx context.Context, urlSaver URLSaver, aliasGenerator AliasGenerator, aliasPolicy AliasPolicy,
+	req Request, uid uint64, appID int,
+) (string, error) {
+	save := func(alias string, id int64) error {
+		opts := storage.SaveOptions{ID: id, ExpiresAt: req.ExpiresAt, MaxClicks: req.MaxClicks}
+		return urlSaver.SaveURL(ctx, req.URL, alias, uid, appID, opts)
+	}
+	if req.Alias != "" {
+		return req.Alias, save(req.Alias, 0)
+	}
+	return aliasGenerator.Generate(ctx, func(alias string, id int64) error {
+		// reserved alias is skipped like a taken one
+		if aliasPolicy.Reserved(alias) {
+			return storage.ErrURLExists
+		}
+		return save(alias, id)
+	})
+}
+
+// ClassifyError returns status, code and detail of error response for Save error
+func ClassifyError(err error) (status int, code string, detail string) {
+	switch {
+	case errors.Is(err, storage.ErrURLExists):
+		return http.StatusConflict, resp.CodeAliasExists, "url already exists"
+	case errors.Is(err, random.ErrAliasesExhausted) || errors.Is(err, sequence.ErrCodesExhausted):
+		return http.StatusServiceUnavailable, resp.CodeUnavailable, "failed to generate alias, try again"
+	default:
+		return http.StatusInternalServerError, resp.CodeInternal, "internal error"
+	}
+}
+
 func responseOK(w http.ResponseWriter, r *http.Request, alias string) {
+	render.Status(r, http.StatusCreated)
 	render.JSON(w, r, Response{
 		Response: resp.OK(),
 		Alias:    alias,
@@ -0,0 +1,100 @@
+package save
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neepooha/url_shortener/internal/lib/aliaspolicy"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/random"
+	"github.com/neepooha/url_shortener/internal/lib/sequence"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generator tries its aliases in order and fails with err when they are taken
+type generator struct {
+	aliases []string
+	err     error
+}
+
+func (g generator) Generate(_ context.Context, save func(alias string, id int64) error) (string, error) {
+	for _, alias := range g.aliases {
+		err := save(alias, 0)
+		if errors.Is(err, storage.ErrURLExists) {
+			continue
+		}
+		return alias, err
+	}
+	return "", g.err
+}
+
+// broken is storage which fails to save links
+type broken struct{}
+
+func (broken) SaveURL(context.Context, string, string, uint64, int, storage.SaveOptions) error {
+	return errors.New("db is down")
+}
+
+func TestSave(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		gen    generator
+		broken bool
+		want   int
+		code   string
+		alias  string
+	}{
+		{name: "custom alias", body: `{"url": "https://go.dev", "alias": "go"}`, want: http.StatusCreated, alias: "go"},
+		{name: "generated alias", body: `{"url": "https://go.dev"}`, gen: generator{aliases: []string{"taken", "free"}}, want: http.StatusCreated, alias: "free"},
+		{name: "reserved generated alias is skipped", body: `{"url": "https://go.dev"}`, gen: generator{aliases: []string{"url", "free"}}, want: http.StatusCreated, alias: "free"},
+		{name: "taken alias", body: `{"url": "https://go.dev", "alias": "taken"}`, want: http.StatusConflict, code: resp.CodeAliasExists},
+		{name: "random aliases exhausted", body: `{"url": "https://go.dev"}`, gen: generator{aliases: []string{"taken"}, err: random.ErrAliasesExhausted}, want: http.StatusServiceUnavailable, code: resp.CodeUnavailable},
+		{name: "sequence codes exhausted", body: `{"url": "https://go.dev"}`, gen: generator{err: sequence.ErrCodesExhausted}, want: http.StatusServiceUnavailable, code: resp.CodeUnavailable},
+		{name: "broken json", body: `{"url": `, want: http.StatusBadRequest, code: resp.CodeInvalidRequest},
+		{name: "invalid url", body: `{"url": "go.dev"}`, want: http.StatusBadRequest, code: resp.CodeValidationFailed},
+		{name: "reserved alias", body: `{"url": "https://go.dev", "alias": "url"}`, want: http.StatusBadRequest, code: resp.CodeValidationFailed},
+		{name: "expiration in the past", body: `{"url": "https://go.dev", "expires_at": "2020-01-01T00:00:00Z"}`, want: http.StatusBadRequest, code: resp.CodeValidationFailed},
+		{name: "storage error", body: `{"url": "https://go.dev", "alias": "go"}`, broken: true, want: http.StatusInternalServerError, code: resp.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.NewStorage()
+			require.NoError(t, st.SaveURL(context.Background(), "https://example.com", "taken", 1, 1, storage.SaveOptions{}))
+			var saver URLSaver = st
+			if tt.broken {
+				saver = broken{}
+			}
+			policy, err := aliaspolicy.New("A-Za-z0-9_-", 2, 64, false)
+			require.NoError(t, err)
+			policy.Reserve("url")
+
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			r := httptest.NewRequest(http.MethodPost, "/url", strings.NewReader(tt.body))
+			r = r.WithContext(get.WithPrincipal(r.Context(), &get.Principal{UID: 2, AppID: 1}))
+			w := httptest.NewRecorder()
+			New(log, saver, tt.gen, policy).ServeHTTP(w, r)
+
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+			if tt.code != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+			}
+			if tt.want == http.StatusCreated {
+				assert.Contains(t, w.Body.String(), `"alias":"`+tt.alias+`"`)
+				owner, err := st.GetURLOwner(context.Background(), tt.alias)
+				require.NoError(t, err)
+				assert.Equal(t, uint64(2), owner)
+			}
+		})
+	}
+}
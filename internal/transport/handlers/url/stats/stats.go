@@ -0,0 +1,156 @@
+package stats
+
+import (
+	"context"
+	"github.com/neepooha/url_shortener/internal/clicks"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Bucket struct {
+	Time           time.Time `json:"time"`
+	Clicks         int64     `json:"clicks"`
+	UniqueVisitors uint64    `json:"unique_visitors"`
+}
+
+type Count struct {
+	Name   string `json:"name"`
+	Clicks int64  `json:"clicks"`
+}
+
+type Response struct {
+	resp.Response
+	Alias          string    `json:"alias"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	Interval       string    `json:"interval"`
+	TotalClicks    int64     `json:"total_clicks"`
+	UniqueVisitors uint64    `json:"unique_visitors"`
+	Buckets        []Bucket  `json:"buckets"`
+	TopReferrers   []Count   `json:"top_referrers"`
+	TopUserAgents  []Count   `json:"top_user_agents"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=StatsGetter
+type StatsGetter interface {
+	ListClickRollups(ctx context.Context, alias string, from time.Time, to time.Time) ([]storage.ClickRollup, error)
+}
+
+const (
+	topSize = 10
+	// limits keep responses small: a month by hours or a year by days
+	maxHourBuckets = 24 * 31
+	maxDayBuckets  = 366
+)
+
+// New returns clicks of the link from rollups.
+// Query params: from, to (RFC 3339, default last 30 days), interval (hour or day, default day).
+func New(log *slog.Logger, statsGetter StatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.stats.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		// get alias from url
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Warn("alias is empty")
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
+			return
+		}
+		log.Info("alias was get from url", slog.String("alias", alias))
+
+		// parse query
+		q := r.URL.Query()
+		interval := q.Get("interval")
+		maxBuckets, step := maxDayBuckets, 24*time.Hour
+		switch interval {
+		case "", clicks.IntervalDay:
+			interval = clicks.IntervalDay
+		case clicks.IntervalHour:
+			maxBuckets, step = maxHourBuckets, time.Hour
+		default:
+			log.Warn("invalid interval", slog.String("interval", interval))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "interval must be hour or day")
+			return
+		}
+
+		to := time.Now().UTC()
+		if t := q.Get("to"); t != "" {
+			parsed, err := time.Parse(time.RFC3339, t)
+			if err != nil {
+				log.Warn("invalid to", sl.Err(err))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "to must be RFC 3339 time")
+				return
+			}
+			to = parsed.UTC()
+		}
+		from := to.Add(-30 * 24 * time.Hour)
+		if f := q.Get("from"); f != "" {
+			parsed, err := time.Parse(time.RFC3339, f)
+			if err != nil {
+				log.Warn("invalid from", sl.Err(err))
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "from must be RFC 3339 time")
+				return
+			}
+			from = parsed.UTC()
+		}
+		from = clicks.TruncateToInterval(from, interval)
+		if !from.Before(to) {
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "from must be before to")
+			return
+		}
+		if to.Sub(from) > time.Duration(maxBuckets)*step {
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "time range is too long for this interval")
+			return
+		}
+
+		rollups, err := statsGetter.ListClickRollups(r.Context(), alias, from, to)
+		if err != nil {
+			log.Error("failed to get click rollups", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		stats := clicks.BuildStats(rollups, from, to, interval, topSize)
+		log.Info("got url stats", slog.Int64("clicks", stats.TotalClicks))
+
+		// response OK
+		buckets := make([]Bucket, 0, len(stats.Buckets))
+		for _, b := range stats.Buckets {
+			buckets = append(buckets, Bucket(b))
+		}
+		render.JSON(w, r, Response{
+			Response:       resp.OK(),
+			Alias:          alias,
+			From:           from,
+			To:             to,
+			Interval:       interval,
+			TotalClicks:    stats.TotalClicks,
+			UniqueVisitors: stats.UniqueVisitors,
+			Buckets:        buckets,
+			TopReferrers:   toCounts(stats.TopReferrers),
+			TopUserAgents:  toCounts(stats.TopUserAgents),
+		})
+	}
+}
+
+func toCounts(counts []clicks.Count) []Count {
+	res := make([]Count, 0, len(counts))
+	for _, c := range counts {
+		res = append(res, Count(c))
+	}
+	return res
+}
@@ -0,0 +1,97 @@
+package update
+
+import (
+	"context"
+	"errors"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type Request struct {
+	URL string `json:"url" validate:"required,url"`
+}
+
+type Response struct {
+	resp.Response
+	Alias string `json:"alias"`
+	URL   string `json:"url"`
+}
+
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=URLUpdater
+type URLUpdater interface {
+	UpdateURL(ctx context.Context, alias string, newURL string, changedBy uint64) error
+}
+
+// New changes destination of the link keeping its alias. Only owner or admin can do it.
+func New(log *slog.Logger, urlUpdater URLUpdater) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.url.update.New"
+
+		// add to log op and reqID
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			sl.TraceID(r.Context()),
+		)
+
+		// editor of the link, only owner or admin gets here
+		uid := get.MustPrincipal(r.Context()).UID
+
+		// get alias from url
+		alias := chi.URLParam(r, "alias")
+		if alias == "" {
+			log.Warn("alias is empty")
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
+			return
+		}
+		log.Info("alias was get from url", slog.String("alias", alias))
+
+		// decode json request
+		var req Request
+		err := render.DecodeJSON(r.Body, &req)
+		if err != nil {
+			log.Error("failed to decode request body", sl.Err(err))
+			resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "failed to decode request")
+			return
+		}
+		log.Info("request body decoded", slog.Any("request", req))
+
+		// validate url
+		if err := validator.New().Struct(req); err != nil {
+			validateErr := err.(validator.ValidationErrors)
+			log.Error("invalid request", sl.Err(err))
+			resp.ValidationError(w, r, validateErr)
+			return
+		}
+
+		// update url in DB
+		err = urlUpdater.UpdateURL(r.Context(), alias, req.URL, uid)
+		if err != nil {
+			if errors.Is(err, storage.ErrURLNotFound) {
+				log.Warn("url by alias was not found", slog.String("alias", alias))
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "url by alias was not found")
+				return
+			}
+			log.Error("failed to update url", sl.Err(err))
+			resp.Internal(w, r)
+			return
+		}
+		log.Info("url updated", slog.String("alias", alias))
+
+		// response OK
+		render.JSON(w, r, Response{
+			Response: resp.OK(),
+			Alias:    alias,
+			URL:      req.URL,
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/storage"
+	"github.com/neepooha/url_shortener/internal/storage/memory"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// broken is storage which fails to update links
+type broken struct{}
+
+func (broken) UpdateURL(context.Context, string, string, uint64) error {
+	return errors.New("db is down")
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		alias  string
+		body   string
+		broken bool
+		want   int
+		code   string
+	}{
+		{name: "link", alias: "link", body: `{"url": "https://go.dev"}`, want: http.StatusOK},
+		{name: "missing link", alias: "missing", body: `{"url": "https://go.dev"}`, want: http.StatusNotFound, code: resp.CodeNotFound},
+		{name: "broken json", alias: "link", body: `{"url": `, want: http.StatusBadRequest, code: resp.CodeInvalidRequest},
+		{name: "invalid url", alias: "link", body: `{"url": "go.dev"}`, want: http.StatusBadRequest, code: resp.CodeValidationFailed},
+		{name: "storage error", alias: "link", body: `{"url": "https://go.dev"}`, broken: true, want: http.StatusInternalServerError, code: resp.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := memory.NewStorage()
+			require.NoError(t, st.SaveURL(context.Background(), "https://example.com", "link", 1, 1, storage.SaveOptions{}))
+			var updater URLUpdater = st
+			if tt.broken {
+				updater = broken{}
+			}
+
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			router := chi.NewRouter()
+			router.Patch("/url/{alias}", New(log, updater))
+			r := httptest.NewRequest(http.MethodPatch, "/url/"+tt.alias, strings.NewReader(tt.body))
+			r = r.WithContext(get.WithPrincipal(r.Context(), &get.Principal{UID: 2, AppID: 1}))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+			if tt.code != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+			}
+			url, err := st.GetURL(context.Background(), "link")
+			require.NoError(t, err)
+			if tt.want == http.StatusOK {
+				assert.Equal(t, "https://go.dev", url)
+			} else {
+				assert.Equal(t, "https://example.com", url)
+			}
+		})
+	}
+}
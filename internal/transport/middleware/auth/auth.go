@@ -1,51 +1,87 @@
 package auth
 
 import (
-	"context"
+	"errors"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/lib/token"
 	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
 	"log/slog"
 	"net/http"
 	"strings"
-
-	"github.com/golang-jwt/jwt"
 )
 
-func New(log *slog.Logger, appSecret string) func(next http.Handler) http.Handler {
+//go:generate go run github.com/vektra/mockery/v2@v2.42.2 --name=TokenVerifier
+type TokenVerifier interface {
+	Verify(tokenStr string) (*token.Claims, error)
+}
+
+func New(log *slog.Logger, verifier TokenVerifier) func(next http.Handler) http.Handler {
 	const op = "middleware.auth.New"
 	log = log.With(slog.String("op", op))
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			tokenStr := extractBearerToken(r)
-			log.Debug("got JWT token", slog.String("jwt-token", tokenStr))
+			tokenStr, ok := extractBearerToken(r)
+			if !ok {
+				log.Warn("malformed authorization header")
+				next.ServeHTTP(w, r.WithContext(get.WithError(r.Context(), get.ErrInvalidToken)))
+				return
+			}
 			if tokenStr == "" {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			tokenParsed, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) { return []byte(appSecret), nil })
+			claims, err := verifier.Verify(tokenStr)
 			if err != nil {
-				log.Warn("failed to parse token", sl.Err(err))
-				ctx := context.WithValue(r.Context(), get.ErrKey, get.ErrInvalidToken)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				log.Warn("failed to verify token", sl.Err(err))
+				next.ServeHTTP(w, r.WithContext(get.WithError(r.Context(), get.ErrInvalidToken)))
 				return
 			}
 
-			claims := tokenParsed.Claims.(jwt.MapClaims)
-			log.Info("user authorized", slog.Any("claims", claims))
-			ctx := context.WithValue(r.Context(), get.UidKey, uint64(claims["uid"].(float64)))
-			ctx = context.WithValue(ctx, get.AppIDKey, uint64(claims["app_id"].(float64)))
-
+			log.Info("user authorized", slog.Uint64("uid", claims.UID), slog.Int("app_id", claims.AppID))
+			ctx := get.WithPrincipal(r.Context(), &get.Principal{
+				UID:   claims.UID,
+				AppID: claims.AppID,
+				Email: claims.Email,
+				Token: tokenStr,
+			})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func extractBearerToken(r *http.Request) string {
+// RequireAuth rejects requests without a valid token, it goes after New
+func RequireAuth(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "middleware.auth.RequireAuth"
+	log = log.With(slog.String("op", op))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := get.PrincipalFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err, ok := get.ErrorFromContext(r.Context()); ok && errors.Is(err, get.ErrInvalidToken) {
+				log.Info("request with invalid token", slog.String("path", r.URL.Path))
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthenticated, "invalid token")
+				return
+			}
+			log.Info("user without logging", slog.String("path", r.URL.Path))
+			resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthenticated, "you are not logged into your account")
+		})
+	}
+}
+
+// extractBearerToken returns token of Authorization header, it's empty without the header.
+// ok is false if the header is set but isn't a bearer token.
+func extractBearerToken(r *http.Request) (tokenStr string, ok bool) {
 	authHeader := r.Header.Get("Authorization")
-	splitToken := strings.Split(authHeader, "Bearer ")
-	if len(splitToken) != 2 {
-		return ""
+	if authHeader == "" {
+		return "", true
+	}
+	tokenStr, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || tokenStr == "" {
+		return "", false
 	}
-	return splitToken[1]
+	return tokenStr, true
 }
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/lib/token"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+// claims are valid claims changed by key-value pairs, nil value deletes the claim
+func claims(kv ...any) jwt.MapClaims {
+	now := time.Now()
+	c := jwt.MapClaims{
+		"uid":    float64(7),
+		"app_id": float64(1),
+		"iss":    "sso",
+		"aud":    "url-shortener",
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+	for i := 0; i < len(kv); i += 2 {
+		if kv[i+1] == nil {
+			delete(c, kv[i].(string))
+		} else {
+			c[kv[i].(string)] = kv[i+1]
+		}
+	}
+	return c
+}
+
+func newHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	verifier, err := token.NewVerifier(token.Secret(secret), token.Options{
+		Methods:  []string{"HS256"},
+		Issuer:   "sso",
+		Audience: "url-shortener",
+	})
+	require.NoError(t, err)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strconv.FormatUint(get.MustPrincipal(r.Context()).UID, 10))
+	})
+	return New(log, verifier)(RequireAuth(log)(ok))
+}
+
+func TestRequireAuth(t *testing.T) {
+	h := newHandler(t)
+	hs256 := func(c jwt.MapClaims) string { return "Bearer " + sign(t, jwt.SigningMethodHS256, []byte(secret), c) }
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		header string
+		// detail of 401, empty if request passes
+		detail string
+	}{
+		{name: "valid", header: hs256(claims())},
+
+		{name: "without header", detail: "you are not logged into your account"},
+		{name: "not bearer", header: "Basic dXNlcjpwYXNz", detail: "invalid token"},
+		{name: "empty bearer", header: "Bearer ", detail: "invalid token"},
+		{name: "bearer in lower case", header: "bearer " + sign(t, jwt.SigningMethodHS256, []byte(secret), claims()), detail: "invalid token"},
+		{name: "bearer twice", header: "Bearer a Bearer b", detail: "invalid token"},
+		{name: "none algorithm", header: "Bearer " + sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims()), detail: "invalid token"},
+		{name: "not allowed algorithm", header: "Bearer " + sign(t, jwt.SigningMethodHS512, []byte(secret), claims()), detail: "invalid token"},
+		{name: "wrong secret", header: "Bearer " + sign(t, jwt.SigningMethodHS256, []byte("other"), claims()), detail: "invalid token"},
+		{name: "expired", header: hs256(claims("exp", now.Add(-time.Minute).Unix())), detail: "invalid token"},
+		{name: "without exp", header: hs256(claims("exp", nil)), detail: "invalid token"},
+		{name: "wrong issuer", header: hs256(claims("iss", "evil")), detail: "invalid token"},
+		{name: "wrong audience", header: hs256(claims("aud", "other-service")), detail: "invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/url", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if tt.detail == "" {
+				require.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "7", w.Body.String())
+				return
+			}
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			var p resp.Problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+			assert.Equal(t, resp.CodeUnauthenticated, p.Code)
+			assert.Equal(t, tt.detail, p.Detail)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package getcontext
 import (
 	"context"
 	"errors"
+	"slices"
 )
 
 type (
@@ -10,10 +11,8 @@ type (
 )
 
 var (
-	ErrKey     key = "errorkey"
-	UidKey     key = "uidkey"
-	AppIDKey   key = "appidkey"
-	IsAdminKey key = "isadminkey"
+	ErrKey       key = "errorkey"
+	PrincipalKey key = "principalkey"
 )
 
 var (
@@ -21,19 +20,57 @@ var (
 	ErrFailedIsAdminCheck = errors.New("failed to check if user is admin")
 )
 
-func APPIDFromContext(ctx context.Context) (int, bool) {
-	appid, ok := ctx.Value(AppIDKey).(int)
-	return appid, ok
+const RoleAdmin = "admin"
+
+// Principal is the user authorized by a token of SSO
+type Principal struct {
+	UID   uint64
+	AppID int
+	Email string
+	// Roles are granted by middleware, e.g. RoleAdmin by isadmin
+	Roles []string
+	// Token is the bearer token of the request
+	Token string
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(RoleAdmin)
+}
+
+// WithRole returns a copy of the principal with the role granted
+func (p *Principal) WithRole(role string) *Principal {
+	if p.HasRole(role) {
+		return p
+	}
+	granted := *p
+	granted.Roles = append(slices.Clip(p.Roles), role)
+	return &granted
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, PrincipalKey, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(PrincipalKey).(*Principal)
+	return p, ok && p != nil
 }
 
-func UIDFromContext(ctx context.Context) (uint64, bool) {
-	uid, ok := ctx.Value(UidKey).(uint64)
-	return uid, ok
+// MustPrincipal is for handlers behind auth.RequireAuth, a route without it panics
+func MustPrincipal(ctx context.Context) *Principal {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		panic("getcontext: no principal in context, route misses auth.RequireAuth")
+	}
+	return p
 }
 
-func IsAdminFromContext(ctx context.Context) (bool, bool) {
-	uid, ok := ctx.Value(IsAdminKey).(bool)
-	return uid, ok
+func WithError(ctx context.Context, err error) context.Context {
+	return context.WithValue(ctx, ErrKey, err)
 }
 
 func ErrorFromContext(ctx context.Context) (error, bool) {
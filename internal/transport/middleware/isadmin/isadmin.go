@@ -2,46 +2,108 @@ package isadmin
 
 import (
 	"context"
+	"errors"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
 	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
+	"github.com/neepooha/url_shortener/internal/storage"
 	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
 	"log/slog"
 	"net/http"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type PermissionProvider interface {
 	IsAdmin(ctx context.Context, userID uint64, appID int) (bool, error)
 }
 
-func New(log *slog.Logger, permProvider PermissionProvider) func(next http.Handler) http.Handler {
-	const op = "middleware.IsAdmin.New"
+type OwnerProvider interface {
+	GetURLOwner(ctx context.Context, alias string) (uint64, error)
+}
+
+// RequireAdmin rejects users who aren't admins of their app.
+// Routes which need admins only for some requests wrap it with middleware.Maybe,
+// so other requests don't wait for SSO.
+func RequireAdmin(log *slog.Logger, permProvider PermissionProvider) func(next http.Handler) http.Handler {
+	const op = "middleware.IsAdmin.RequireAdmin"
 	log = log.With(slog.String("op", op))
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			uid, ok := get.UIDFromContext(r.Context())
+			user, ok := get.PrincipalFromContext(r.Context())
 			if !ok {
-				log.Error("failed to get UID user")
-				ctx := context.WithValue(r.Context(), get.ErrKey, get.ErrFailedIsAdminCheck)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				log.Info("user without logging")
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthenticated, "you are not logged into your account")
+				return
+			}
+
+			isAdmin, err := permProvider.IsAdmin(r.Context(), user.UID, user.AppID)
+			if err != nil {
+				log.Error("failed to check if user is admin", sl.Err(err))
+				unavailable(w, r)
+				return
+			}
+			if !isAdmin {
+				log.Info("user isn't admin", slog.Uint64("uid", user.UID))
+				resp.Error(w, r, http.StatusForbidden, resp.CodeForbidden, "you are not admin")
 				return
 			}
+			next.ServeHTTP(w, r.WithContext(get.WithPrincipal(r.Context(), user.WithRole(get.RoleAdmin))))
+		})
+	}
+}
 
-			appID, ok := get.APPIDFromContext(r.Context())
+// RequireOwnerOrAdmin lets through the owner of the link of {alias} and admins.
+// Admins are checked only for other users, so owners keep access when SSO fails.
+// A link of another user looks like a missing one, so aliases can't be probed.
+func RequireOwnerOrAdmin(log *slog.Logger, permProvider PermissionProvider, owners OwnerProvider) func(next http.Handler) http.Handler {
+	const op = "middleware.IsAdmin.RequireOwnerOrAdmin"
+	log = log.With(slog.String("op", op))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := get.PrincipalFromContext(r.Context())
 			if !ok {
-				log.Error("failed to get APPID")
-				ctx := context.WithValue(r.Context(), get.ErrKey, get.ErrFailedIsAdminCheck)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				log.Info("user without logging")
+				resp.Error(w, r, http.StatusUnauthorized, resp.CodeUnauthenticated, "you are not logged into your account")
 				return
 			}
 
-			isAdmin, err := permProvider.IsAdmin(r.Context(), uid, appID)
+			alias := chi.URLParam(r, "alias")
+			if alias == "" {
+				log.Warn("alias is empty")
+				resp.Error(w, r, http.StatusBadRequest, resp.CodeInvalidRequest, "invalid request")
+				return
+			}
+			ownerUID, err := owners.GetURLOwner(r.Context(), alias)
+			found := err == nil
+			if err != nil && !errors.Is(err, storage.ErrURLNotFound) {
+				log.Error("failed to get url owner", sl.Err(err))
+				resp.Internal(w, r)
+				return
+			}
+			if found && ownerUID == user.UID {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// missing links are checked too, so they answer like links of others
+			isAdmin, err := permProvider.IsAdmin(r.Context(), user.UID, user.AppID)
 			if err != nil {
 				log.Error("failed to check if user is admin", sl.Err(err))
-				ctx := context.WithValue(r.Context(), get.ErrKey, get.ErrFailedIsAdminCheck)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				unavailable(w, r)
+				return
+			}
+			if !isAdmin || !found {
+				log.Info("url by alias was not found or user aren't owner or admin",
+					slog.Uint64("uid", user.UID), slog.String("alias", alias))
+				resp.Error(w, r, http.StatusNotFound, resp.CodeNotFound, "url by alias was not found")
 				return
 			}
-			ctx := context.WithValue(r.Context(), get.IsAdminKey, isAdmin)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(get.WithPrincipal(r.Context(), user.WithRole(get.RoleAdmin))))
 		})
 	}
 }
+
+// unavailable answers when SSO can't tell if the user is admin, the request may succeed later
+func unavailable(w http.ResponseWriter, r *http.Request) {
+	resp.Error(w, r, http.StatusServiceUnavailable, resp.CodeUnavailable, "failed to check if user is admin, try again")
+}
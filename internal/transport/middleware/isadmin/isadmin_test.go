@@ -0,0 +1,171 @@
+package isadmin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	resp "github.com/neepooha/url_shortener/internal/lib/api/response"
+	"github.com/neepooha/url_shortener/internal/storage"
+	get "github.com/neepooha/url_shortener/internal/transport/middleware/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	owner = 1
+	admin = 2
+	other = 3
+)
+
+// perms are admins of app 1, err fails every check, calls are counted
+type perms struct {
+	admins map[uint64]bool
+	err    error
+	calls  int
+}
+
+func (p *perms) IsAdmin(_ context.Context, uid uint64, appID int) (bool, error) {
+	p.calls++
+	if p.err != nil {
+		return false, p.err
+	}
+	return appID == 1 && p.admins[uid], nil
+}
+
+// owners are owners of links by alias, err fails every lookup
+type owners struct {
+	links map[string]uint64
+	err   error
+}
+
+func (o owners) GetURLOwner(_ context.Context, alias string) (uint64, error) {
+	if o.err != nil {
+		return 0, o.err
+	}
+	uid, ok := o.links[alias]
+	if !ok {
+		return 0, storage.ErrURLNotFound
+	}
+	return uid, nil
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// roles answers with roles of the principal which passed the middleware
+var roles = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(get.MustPrincipal(r.Context()).Roles)
+})
+
+func serve(t *testing.T, h http.Handler, target string, user *get.Principal) (*httptest.ResponseRecorder, []string) {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if user != nil {
+		r = r.WithContext(get.WithPrincipal(r.Context(), user))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		var p resp.Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+		assert.Equal(t, w.Code, p.Status)
+		return w, nil
+	}
+	var granted []string
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&granted))
+	return w, granted
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  *get.Principal
+		err   error
+		want  int
+		calls int
+	}{
+		{name: "admin", user: &get.Principal{UID: admin, AppID: 1}, want: http.StatusOK, calls: 1},
+		{name: "not admin", user: &get.Principal{UID: other, AppID: 1}, want: http.StatusForbidden, calls: 1},
+		{name: "admin of another app", user: &get.Principal{UID: admin, AppID: 2}, want: http.StatusForbidden, calls: 1},
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "sso error", user: &get.Principal{UID: admin, AppID: 1}, err: errors.New("sso is down"), want: http.StatusServiceUnavailable, calls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &perms{admins: map[uint64]bool{admin: true}, err: tt.err}
+			w, granted := serve(t, RequireAdmin(discard, p)(roles), "/url", tt.user)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Equal(t, tt.calls, p.calls)
+			if tt.want == http.StatusOK {
+				assert.Equal(t, []string{get.RoleAdmin}, granted)
+			}
+		})
+	}
+}
+
+func TestRequireAdminMaybe(t *testing.T) {
+	p := &perms{err: errors.New("sso is down")}
+	h := middleware.Maybe(RequireAdmin(discard, p), func(r *http.Request) bool {
+		return r.URL.Query().Get("all") == "true"
+	})(roles)
+	user := &get.Principal{UID: owner, AppID: 1}
+
+	w, granted := serve(t, h, "/url", user)
+	assert.Equal(t, http.StatusOK, w.Code, "own links don't need sso")
+	assert.Empty(t, granted)
+	assert.Equal(t, 0, p.calls)
+
+	w, _ = serve(t, h, "/url?all=true", user)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, 1, p.calls)
+}
+
+func TestRequireOwnerOrAdmin(t *testing.T) {
+	links := owners{links: map[string]uint64{"link": owner}}
+
+	tests := []struct {
+		name   string
+		alias  string
+		user   *get.Principal
+		owners OwnerProvider
+		err    error
+		want   int
+		// admin role is granted
+		admin bool
+		calls int
+	}{
+		{name: "owner", alias: "link", user: &get.Principal{UID: owner, AppID: 1}, owners: links, want: http.StatusOK},
+		{name: "owner when sso fails", alias: "link", user: &get.Principal{UID: owner, AppID: 1}, owners: links, err: errors.New("sso is down"), want: http.StatusOK},
+		{name: "admin", alias: "link", user: &get.Principal{UID: admin, AppID: 1}, owners: links, want: http.StatusOK, admin: true, calls: 1},
+		{name: "other user", alias: "link", user: &get.Principal{UID: other, AppID: 1}, owners: links, want: http.StatusNotFound, calls: 1},
+		{name: "missing link", alias: "missing", user: &get.Principal{UID: other, AppID: 1}, owners: links, want: http.StatusNotFound, calls: 1},
+		{name: "missing link of admin", alias: "missing", user: &get.Principal{UID: admin, AppID: 1}, owners: links, want: http.StatusNotFound, calls: 1},
+		{name: "other user when sso fails", alias: "link", user: &get.Principal{UID: other, AppID: 1}, owners: links, err: errors.New("sso is down"), want: http.StatusServiceUnavailable, calls: 1},
+		{name: "storage error", alias: "link", user: &get.Principal{UID: owner, AppID: 1}, owners: owners{err: errors.New("db is down")}, want: http.StatusInternalServerError},
+		{name: "anonymous", alias: "link", owners: links, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &perms{admins: map[uint64]bool{admin: true}, err: tt.err}
+			router := chi.NewRouter()
+			router.With(RequireOwnerOrAdmin(discard, p, tt.owners)).Get("/url/{alias}", roles)
+			w, granted := serve(t, router, "/url/"+tt.alias, tt.user)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Equal(t, tt.calls, p.calls)
+			if tt.want == http.StatusOK {
+				assert.Equal(t, tt.admin, len(granted) == 1 && granted[0] == get.RoleAdmin)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"github.com/neepooha/url_shortener/internal/lib/logger/sl"
 	"net/http"
 	"time"
 
@@ -23,6 +24,7 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 				slog.String("remote_addr", r.RemoteAddr),
 				slog.String("user_agent", r.UserAgent()),
 				slog.String("request_id", middleware.GetReqID(r.Context())),
+				sl.TraceID(r.Context()),
 			)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
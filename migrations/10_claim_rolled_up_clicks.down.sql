@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS click_rollup_state
+(
+		id            INTEGER PRIMARY KEY CHECK (id = 1),
+		last_click_id BIGINT  NOT NULL
+);
+INSERT INTO click_rollup_state (id, last_click_id)
+SELECT 1, COALESCE(MAX(id), 0) FROM clicks WHERE rolled_up ON CONFLICT DO NOTHING;
+DROP INDEX IF EXISTS idx_clicks_not_rolled_up;
+ALTER TABLE clicks DROP COLUMN IF EXISTS rolled_up;
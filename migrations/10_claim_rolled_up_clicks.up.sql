@@ -0,0 +1,4 @@
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS rolled_up BOOLEAN NOT NULL DEFAULT false;
+UPDATE clicks SET rolled_up = true WHERE id <= (SELECT last_click_id FROM click_rollup_state WHERE id = 1);
+CREATE INDEX IF NOT EXISTS idx_clicks_not_rolled_up on clicks(id) WHERE NOT rolled_up;
+DROP TABLE IF EXISTS click_rollup_state;
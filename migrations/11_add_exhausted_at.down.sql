@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_exhausted_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS exhausted_at;
@@ -0,0 +1,4 @@
+DELETE FROM clicks WHERE alias NOT IN (SELECT alias FROM urls);
+DELETE FROM click_rollups WHERE alias NOT IN (SELECT alias FROM urls);
+DELETE FROM click_referrer_rollups WHERE alias NOT IN (SELECT alias FROM urls);
+DELETE FROM click_agent_rollups WHERE alias NOT IN (SELECT alias FROM urls);
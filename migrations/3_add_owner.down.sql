@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_owner_uid;
+ALTER TABLE urls DROP COLUMN IF EXISTS app_id;
+ALTER TABLE urls DROP COLUMN IF EXISTS owner_uid;
@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS owner_uid BIGINT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS app_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_owner_uid on urls(owner_uid);
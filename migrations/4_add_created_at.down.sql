@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_alias_pattern;
+DROP INDEX IF EXISTS idx_host;
+DROP INDEX IF EXISTS idx_created;
+DROP INDEX IF EXISTS idx_owner_created;
+CREATE INDEX IF NOT EXISTS idx_owner_uid on urls(owner_uid);
+ALTER TABLE urls DROP COLUMN IF EXISTS host;
+ALTER TABLE urls DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,8 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS host TEXT NOT NULL DEFAULT '';
+UPDATE urls SET host = lower(coalesce(substring(url from '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:]+)'), ''));
+DROP INDEX IF EXISTS idx_owner_uid;
+CREATE INDEX IF NOT EXISTS idx_owner_created on urls(owner_uid, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_created on urls(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_host on urls(host);
+CREATE INDEX IF NOT EXISTS idx_alias_pattern on urls(alias text_pattern_ops);
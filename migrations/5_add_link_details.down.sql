@@ -0,0 +1,3 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS clicks;
+ALTER TABLE urls DROP COLUMN IF EXISTS redirect_type;
+ALTER TABLE urls DROP COLUMN IF EXISTS updated_at;
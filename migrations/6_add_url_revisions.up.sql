@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS url_revisions
+(
+		id         SERIAL      PRIMARY KEY,
+		url_id     INTEGER     NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+		url        TEXT        NOT NULL,
+		changed_by BIGINT      NOT NULL,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_url_revisions_url_id on url_revisions(url_id, id);
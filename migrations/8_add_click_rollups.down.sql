@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS click_rollup_state;
+DROP TABLE IF EXISTS click_agent_rollups;
+DROP TABLE IF EXISTS click_referrer_rollups;
+DROP TABLE IF EXISTS click_rollups;
@@ -0,0 +1,20 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks BIGINT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS used_clicks BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_expires_at on urls(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_max_clicks on urls(alias) WHERE max_clicks IS NOT NULL;
+CREATE TABLE IF NOT EXISTS urls_archive
+(
+		id          INTEGER     PRIMARY KEY,
+		alias       TEXT        NOT NULL,
+		url         TEXT        NOT NULL,
+		owner_uid   BIGINT,
+		app_id      INTEGER,
+		created_at  TIMESTAMPTZ NOT NULL,
+		expires_at  TIMESTAMPTZ,
+		max_clicks  BIGINT,
+		used_clicks BIGINT      NOT NULL,
+		clicks      BIGINT      NOT NULL,
+		archived_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_urls_archive_alias on urls_archive(alias);
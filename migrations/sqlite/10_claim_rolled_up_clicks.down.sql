@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS click_rollup_state
+(
+		id            INTEGER PRIMARY KEY CHECK (id = 1),
+		last_click_id INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO click_rollup_state (id, last_click_id)
+SELECT 1, COALESCE(MAX(id), 0) FROM clicks WHERE rolled_up = 1;
+DROP INDEX IF EXISTS idx_clicks_not_rolled_up;
+ALTER TABLE clicks DROP COLUMN rolled_up;
@@ -0,0 +1,4 @@
+ALTER TABLE clicks ADD COLUMN rolled_up INTEGER NOT NULL DEFAULT 0;
+UPDATE clicks SET rolled_up = 1 WHERE id <= (SELECT last_click_id FROM click_rollup_state WHERE id = 1);
+CREATE INDEX IF NOT EXISTS idx_clicks_not_rolled_up on clicks(id) WHERE rolled_up = 0;
+DROP TABLE IF EXISTS click_rollup_state;
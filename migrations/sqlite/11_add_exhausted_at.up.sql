@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN exhausted_at DATETIME;
+UPDATE urls SET exhausted_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE max_clicks IS NOT NULL AND used_clicks >= max_clicks;
+CREATE INDEX IF NOT EXISTS idx_exhausted_at on urls(exhausted_at) WHERE exhausted_at IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS urls;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS urls
+(
+		id    INTEGER PRIMARY KEY AUTOINCREMENT,
+		alias TEXT NOT NULL UNIQUE,
+		url   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_alias on urls(alias);
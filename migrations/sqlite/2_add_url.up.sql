@@ -0,0 +1,2 @@
+INSERT OR IGNORE INTO urls (alias, url)
+VALUES ('habr', 'https://habr.com/');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_owner_uid;
+ALTER TABLE urls DROP COLUMN app_id;
+ALTER TABLE urls DROP COLUMN owner_uid;
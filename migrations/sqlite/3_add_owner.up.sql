@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN owner_uid INTEGER;
+ALTER TABLE urls ADD COLUMN app_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_owner_uid on urls(owner_uid);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_host;
+DROP INDEX IF EXISTS idx_created;
+DROP INDEX IF EXISTS idx_owner_created;
+CREATE INDEX IF NOT EXISTS idx_owner_uid on urls(owner_uid);
+ALTER TABLE urls DROP COLUMN host;
+ALTER TABLE urls DROP COLUMN created_at;
@@ -0,0 +1,12 @@
+ALTER TABLE urls ADD COLUMN created_at DATETIME;
+ALTER TABLE urls ADD COLUMN host TEXT NOT NULL DEFAULT '';
+UPDATE urls SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE created_at IS NULL;
+UPDATE urls SET host = lower(
+	CASE WHEN instr(substr(url, instr(url, '://') + 3), '/') > 0
+	THEN substr(substr(url, instr(url, '://') + 3), 1, instr(substr(url, instr(url, '://') + 3), '/') - 1)
+	ELSE substr(url, instr(url, '://') + 3) END
+) WHERE instr(url, '://') > 0;
+DROP INDEX IF EXISTS idx_owner_uid;
+CREATE INDEX IF NOT EXISTS idx_owner_created on urls(owner_uid, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_created on urls(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_host on urls(host);
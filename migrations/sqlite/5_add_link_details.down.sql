@@ -0,0 +1,3 @@
+ALTER TABLE urls DROP COLUMN clicks;
+ALTER TABLE urls DROP COLUMN redirect_type;
+ALTER TABLE urls DROP COLUMN updated_at;
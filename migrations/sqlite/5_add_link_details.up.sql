@@ -0,0 +1,4 @@
+ALTER TABLE urls ADD COLUMN updated_at DATETIME;
+ALTER TABLE urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 302;
+ALTER TABLE urls ADD COLUMN clicks INTEGER NOT NULL DEFAULT 0;
+UPDATE urls SET updated_at = created_at;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS clicks
+(
+		id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+		alias      TEXT     NOT NULL,
+		clicked_at DATETIME NOT NULL,
+		referrer   TEXT     NOT NULL DEFAULT '',
+		user_agent TEXT     NOT NULL DEFAULT '',
+		ip_hash    TEXT     NOT NULL DEFAULT '',
+		request_id TEXT     NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_clicks_alias_time on clicks(alias, clicked_at);
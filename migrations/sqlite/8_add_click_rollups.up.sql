@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS click_rollups
+(
+		alias    TEXT        NOT NULL,
+		bucket   DATETIME    NOT NULL,
+		clicks   INTEGER     NOT NULL DEFAULT 0,
+		visitors BLOB        NOT NULL,
+		PRIMARY KEY (alias, bucket)
+);
+CREATE TABLE IF NOT EXISTS click_referrer_rollups
+(
+		alias    TEXT        NOT NULL,
+		bucket   DATETIME    NOT NULL,
+		referrer TEXT        NOT NULL,
+		clicks   INTEGER     NOT NULL DEFAULT 0,
+		PRIMARY KEY (alias, bucket, referrer)
+);
+CREATE TABLE IF NOT EXISTS click_agent_rollups
+(
+		alias    TEXT        NOT NULL,
+		bucket   DATETIME    NOT NULL,
+		family   TEXT        NOT NULL,
+		clicks   INTEGER     NOT NULL DEFAULT 0,
+		PRIMARY KEY (alias, bucket, family)
+);
+CREATE TABLE IF NOT EXISTS click_rollup_state
+(
+		id            INTEGER PRIMARY KEY CHECK (id = 1),
+		last_click_id INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO click_rollup_state (id, last_click_id) VALUES (1, 0);
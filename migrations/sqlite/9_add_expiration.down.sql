@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS urls_archive;
+DROP INDEX IF EXISTS idx_max_clicks;
+DROP INDEX IF EXISTS idx_expires_at;
+ALTER TABLE urls DROP COLUMN used_clicks;
+ALTER TABLE urls DROP COLUMN max_clicks;
+ALTER TABLE urls DROP COLUMN expires_at;
@@ -0,0 +1,20 @@
+ALTER TABLE urls ADD COLUMN expires_at DATETIME;
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER;
+ALTER TABLE urls ADD COLUMN used_clicks INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_expires_at on urls(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_max_clicks on urls(alias) WHERE max_clicks IS NOT NULL;
+CREATE TABLE IF NOT EXISTS urls_archive
+(
+		id          INTEGER  PRIMARY KEY,
+		alias       TEXT     NOT NULL,
+		url         TEXT     NOT NULL,
+		owner_uid   INTEGER,
+		app_id      INTEGER,
+		created_at  DATETIME NOT NULL,
+		expires_at  DATETIME,
+		max_clicks  INTEGER,
+		used_clicks INTEGER  NOT NULL,
+		clicks      INTEGER  NOT NULL,
+		archived_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_urls_archive_alias on urls_archive(alias);